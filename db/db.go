@@ -1,10 +1,13 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
+	"rentx/utils"
+	"slices"
 
 	"golang.org/x/crypto/bcrypt"
 	_ "modernc.org/sqlite"
@@ -13,20 +16,16 @@ import (
 var DB *sql.DB
 
 func InitDB() {
-	db, err := sql.Open("sqlite", "api.db")
+	// busy_timeout and foreign_keys are per-connection settings, so they are
+	// passed in the DSN to apply to every pooled connection. Transactions take
+	// the write lock up front so read-then-write checks (e.g. booking overlaps)
+	// cannot interleave.
+	db, err := sql.Open("sqlite", "api.db?_txlock=immediate&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)")
 	if err != nil {
 		log.Fatal("Database could not connect: ", err)
 	}
 	DB = db
 
-	if _, err = DB.Exec("PRAGMA busy_timeout = 5000;"); err != nil {
-		log.Fatal("Could not set busy_timeout: ", err)
-	}
-
-	if _, err = DB.Exec("PRAGMA foreign_keys = ON;"); err != nil {
-		log.Fatal("Could not enable foreign keys: ", err)
-	}
-
 	if _, err = DB.Exec("PRAGMA journal_mode=WAL;"); err != nil {
 		log.Fatal("Could not enable WAL: ", err)
 	}
@@ -39,6 +38,26 @@ func InitDB() {
 		log.Fatal("Database table creation failed: ", err)
 	}
 
+	if err := createSearchIndex(); err != nil {
+		log.Fatal("Search index creation failed: ", err)
+	}
+
+	if err := createUploadReferences(); err != nil {
+		log.Fatal("Upload reference tracking setup failed: ", err)
+	}
+
+	if err := backfillCategorySlugs(); err != nil {
+		log.Fatal("Category slug backfill failed: ", err)
+	}
+
+	if err := createCategoryDeleteGuard(); err != nil {
+		log.Fatal("Category delete guard creation failed: ", err)
+	}
+
+	if err := createRatingAggregates(); err != nil {
+		log.Fatal("Rating aggregate setup failed: ", err)
+	}
+
 	createDefaultSuperAdmin()
 
 	fmt.Println("✅ Database initialized, tables created and superadmin ensured!")
@@ -90,6 +109,23 @@ func createDefaultSuperAdmin() {
 	}
 }
 
+// uploadsTable defines the uploads table (stored images and their resized
+// variants), one row per distinct file content
+const uploadsTable = `(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	url TEXT NOT NULL UNIQUE, -- full-size image, as referenced by post_images.imageUrl
+	thumbUrl TEXT NOT NULL,
+	mediumUrl TEXT NOT NULL,
+	largeUrl TEXT NOT NULL,
+	mime TEXT NOT NULL,
+	width INTEGER NOT NULL,
+	height INTEGER NOT NULL,
+	storageKey TEXT NOT NULL DEFAULT '', -- file store key of the full-size image; variants add _<size>
+	contentHash TEXT NOT NULL DEFAULT '', -- SHA-256 of the uploaded file
+	refCount INTEGER NOT NULL DEFAULT 0, -- post_images rows using url, kept by triggers
+	dateTime DATETIME DEFAULT CURRENT_TIMESTAMP
+)`
+
 func createTables() error {
 	tables := []string{
 		// Users table
@@ -117,8 +153,30 @@ func createTables() error {
 		// Categories table
 		`CREATE TABLE IF NOT EXISTS categories (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			parentId INTEGER, -- NULL for top-level categories
 			name TEXT NOT NULL,
-			dateTime DATETIME DEFAULT CURRENT_TIMESTAMP
+			slug TEXT NOT NULL DEFAULT '', -- unique once set; see backfillCategorySlugs
+			dateTime DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (parentId) REFERENCES categories (id) ON DELETE SET NULL
+		)`,
+
+		// Category attributes table (typed fields that posts of a category and
+		// of its subcategories fill in)
+		`CREATE TABLE IF NOT EXISTS category_attributes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			categoryId INTEGER NOT NULL,
+			key TEXT NOT NULL, -- e.g. 'seats'; a subcategory may redefine a key of an ancestor
+			label TEXT NOT NULL,
+			type TEXT NOT NULL, -- 'enum' | 'number' | 'boolean' | 'text'
+			unit TEXT NOT NULL DEFAULT '', -- numbers only, e.g. 'km'
+			options TEXT NOT NULL DEFAULT '[]', -- JSON array of the allowed enum values
+			minValue REAL, -- numbers only; NULL for no limit
+			maxValue REAL,
+			required INTEGER NOT NULL DEFAULT 0,
+			position INTEGER NOT NULL DEFAULT 0,
+			dateTime DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (categoryId, key),
+			FOREIGN KEY (categoryId) REFERENCES categories (id) ON DELETE CASCADE
 		)`,
 
 		// Posts table
@@ -132,10 +190,40 @@ func createTables() error {
 			dailyPrice REAL NOT NULL,
 			weeklyPrice REAL NOT NULL,
 			monthlyPrice REAL NOT NULL,
-			status TEXT NOT NULL DEFAULT 'pending',
+			latitude REAL,  -- NULL until set or geocoded
+			longitude REAL,
+			status TEXT NOT NULL DEFAULT 'pending', -- 'pending' | 'approved' | 'rejected'
+			moderationReason TEXT NOT NULL DEFAULT '', -- reason of the latest rejection
+			ratingAverage REAL NOT NULL DEFAULT 0, -- of rated reviews, kept by triggers
+			ratingCount INTEGER NOT NULL DEFAULT 0,
 			dateTime DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (userId) REFERENCES users (id) ON DELETE CASCADE,
-			FOREIGN KEY (categoryId) REFERENCES categories (id) ON DELETE CASCADE
+			FOREIGN KEY (categoryId) REFERENCES categories (id) ON DELETE RESTRICT
+		)`,
+
+		// Post moderation history table (every status decision on a post)
+		`CREATE TABLE IF NOT EXISTS post_moderation_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			postId INTEGER NOT NULL,
+			fromStatus TEXT NOT NULL DEFAULT '', -- empty for the initial status
+			toStatus TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			actorId INTEGER NOT NULL,
+			dateTime DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (postId) REFERENCES posts (id) ON DELETE CASCADE
+		)`,
+
+		// Uploads table
+		`CREATE TABLE IF NOT EXISTS uploads ` + uploadsTable,
+
+		// Upload owners table (users who uploaded a file and may attach it to posts)
+		`CREATE TABLE IF NOT EXISTS upload_owners (
+			uploadId INTEGER NOT NULL,
+			userId INTEGER NOT NULL,
+			dateTime DATETIME DEFAULT CURRENT_TIMESTAMP, -- last time the user uploaded the file
+			PRIMARY KEY (uploadId, userId),
+			FOREIGN KEY (uploadId) REFERENCES uploads (id) ON DELETE CASCADE,
+			FOREIGN KEY (userId) REFERENCES users (id) ON DELETE CASCADE
 		)`,
 
 		// Post images table (normalized)
@@ -144,6 +232,41 @@ func createTables() error {
 			postId INTEGER NOT NULL,
 			imageUrl TEXT NOT NULL,
 			position INTEGER DEFAULT 0,
+			altText TEXT NOT NULL DEFAULT '',
+			caption TEXT NOT NULL DEFAULT '',
+			isCover INTEGER NOT NULL DEFAULT 0, -- at most one per post; none means the first image
+			FOREIGN KEY (postId) REFERENCES posts (id) ON DELETE CASCADE
+		)`,
+
+		// Post attributes table (validated values of the category attributes)
+		`CREATE TABLE IF NOT EXISTS post_attributes (
+			postId INTEGER NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL, -- JSON: a number, true/false or a string
+			PRIMARY KEY (postId, key),
+			FOREIGN KEY (postId) REFERENCES posts (id) ON DELETE CASCADE
+		)`,
+
+		// Post blackouts table (owner-blocked date ranges, inclusive)
+		`CREATE TABLE IF NOT EXISTS post_blackouts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			postId INTEGER NOT NULL,
+			startDate TEXT NOT NULL,
+			endDate TEXT NOT NULL,
+			reason TEXT NOT NULL DEFAULT '',
+			source TEXT NOT NULL DEFAULT 'manual', -- 'manual' | 'ical-url' | 'ical-upload'
+			externalUid TEXT NOT NULL DEFAULT '',
+			dateTime DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (postId) REFERENCES posts (id) ON DELETE CASCADE
+		)`,
+
+		// Post calendars table (iCalendar feed token and external feed to import)
+		`CREATE TABLE IF NOT EXISTS post_calendars (
+			postId INTEGER PRIMARY KEY,
+			feedToken TEXT NOT NULL UNIQUE,
+			importUrl TEXT NOT NULL DEFAULT '',
+			lastSyncedAt DATETIME,
+			lastSyncError TEXT NOT NULL DEFAULT '',
 			FOREIGN KEY (postId) REFERENCES posts (id) ON DELETE CASCADE
 		)`,
 
@@ -152,36 +275,427 @@ func createTables() error {
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			userId INTEGER NOT NULL,
 			postId INTEGER NOT NULL,
+			startDate TEXT NOT NULL DEFAULT '', -- YYYY-MM-DD, inclusive
+			endDate TEXT NOT NULL DEFAULT '',   -- YYYY-MM-DD, inclusive
+			status TEXT NOT NULL DEFAULT 'requested', -- 'requested' | 'accepted' | 'declined' | 'active' | 'returned' | 'completed' | 'cancelled'
+			totalPrice REAL NOT NULL DEFAULT 0,
 			dateTime DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (userId) REFERENCES users (id) ON DELETE CASCADE,
 			FOREIGN KEY (postId) REFERENCES posts (id) ON DELETE CASCADE
 		)`,
 
+		// Order line items table (price breakdown agreed at booking time)
+		`CREATE TABLE IF NOT EXISTS order_line_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			orderId INTEGER NOT NULL,
+			unit TEXT NOT NULL, -- 'month' | 'week' | 'day'
+			quantity INTEGER NOT NULL,
+			unitPrice REAL NOT NULL,
+			amount REAL NOT NULL,
+			FOREIGN KEY (orderId) REFERENCES orders (id) ON DELETE CASCADE
+		)`,
+
+		// Order status history table (who moved an order to which status, and when)
+		`CREATE TABLE IF NOT EXISTS order_status_history (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			orderId INTEGER NOT NULL,
+			fromStatus TEXT NOT NULL,
+			toStatus TEXT NOT NULL,
+			actorId INTEGER NOT NULL,
+			dateTime DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (orderId) REFERENCES orders (id) ON DELETE CASCADE
+		)`,
+
 		// Reviews table
 		`CREATE TABLE IF NOT EXISTS reviews (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			userId INTEGER NOT NULL,
 			postId INTEGER NOT NULL,
 			review TEXT NOT NULL,
+			rating INTEGER NOT NULL DEFAULT 0, -- 1-5 stars; 0 for reviews written before ratings
+			accuracyRating INTEGER, -- optional sub-ratings, 1-5 stars
+			communicationRating INTEGER,
+			conditionRating INTEGER,
+			orderId INTEGER, -- the rental reviewed, one review each; NULL for reviews written before
 			dateTime DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (userId) REFERENCES users (id) ON DELETE CASCADE,
-			FOREIGN KEY (postId) REFERENCES posts (id) ON DELETE CASCADE
+			FOREIGN KEY (postId) REFERENCES posts (id) ON DELETE CASCADE,
+			FOREIGN KEY (orderId) REFERENCES orders (id) ON DELETE SET NULL
 		)`,
+	}
+
+	for _, table := range tables {
+		if _, err := DB.Exec(table); err != nil {
+			return fmt.Errorf("error creating table/index: %w", err)
+		}
+	}
+
+	// Columns added after the first release; CREATE TABLE IF NOT EXISTS
+	// leaves existing tables untouched, so older databases get them here.
+	columns := []struct{ table, column, definition string }{
+		{"orders", "startDate", "TEXT NOT NULL DEFAULT ''"},
+		{"orders", "endDate", "TEXT NOT NULL DEFAULT ''"},
+		{"orders", "totalPrice", "REAL NOT NULL DEFAULT 0"},
+		{"orders", "status", "TEXT NOT NULL DEFAULT 'requested'"},
+		{"post_blackouts", "source", "TEXT NOT NULL DEFAULT 'manual'"},
+		{"post_blackouts", "externalUid", "TEXT NOT NULL DEFAULT ''"},
+		{"posts", "latitude", "REAL"},
+		{"posts", "longitude", "REAL"},
+		{"posts", "moderationReason", "TEXT NOT NULL DEFAULT ''"},
+		{"uploads", "storageKey", "TEXT NOT NULL DEFAULT ''"},
+		{"uploads", "contentHash", "TEXT NOT NULL DEFAULT ''"},
+		{"uploads", "refCount", "INTEGER NOT NULL DEFAULT 0"},
+		{"post_images", "altText", "TEXT NOT NULL DEFAULT ''"},
+		{"post_images", "caption", "TEXT NOT NULL DEFAULT ''"},
+		{"post_images", "isCover", "INTEGER NOT NULL DEFAULT 0"},
+		{"categories", "parentId", "INTEGER REFERENCES categories (id) ON DELETE SET NULL"},
+		{"categories", "slug", "TEXT NOT NULL DEFAULT ''"},
+		{"reviews", "rating", "INTEGER NOT NULL DEFAULT 0"},
+		{"reviews", "accuracyRating", "INTEGER"},
+		{"reviews", "communicationRating", "INTEGER"},
+		{"reviews", "conditionRating", "INTEGER"},
+		{"reviews", "orderId", "INTEGER REFERENCES orders (id) ON DELETE SET NULL"},
+		{"posts", "ratingAverage", "REAL NOT NULL DEFAULT 0"},
+		{"posts", "ratingCount", "INTEGER NOT NULL DEFAULT 0"},
+	}
 
-		// Indexes
+	for _, col := range columns {
+		if err := addColumnIfMissing(col.table, col.column, col.definition); err != nil {
+			return err
+		}
+	}
+
+	indexes := []string{
 		`CREATE INDEX IF NOT EXISTS idx_posts_categoryId ON posts(categoryId)`,
 		`CREATE INDEX IF NOT EXISTS idx_orders_userId ON orders(userId)`,
 		`CREATE INDEX IF NOT EXISTS idx_orders_postId ON orders(postId)`,
 		`CREATE INDEX IF NOT EXISTS idx_reviews_userId ON reviews(userId)`,
 		`CREATE INDEX IF NOT EXISTS idx_reviews_postId ON reviews(postId)`,
 		`CREATE INDEX IF NOT EXISTS idx_post_images_postId ON post_images(postId)`,
+		`CREATE INDEX IF NOT EXISTS idx_orders_postId_dates ON orders(postId, startDate, endDate)`,
+		`CREATE INDEX IF NOT EXISTS idx_order_line_items_orderId ON order_line_items(orderId)`,
+		`CREATE INDEX IF NOT EXISTS idx_order_status_history_orderId ON order_status_history(orderId)`,
+		`CREATE INDEX IF NOT EXISTS idx_post_blackouts_postId_dates ON post_blackouts(postId, startDate, endDate)`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_latitude_longitude ON posts(latitude, longitude)`,
+		`CREATE INDEX IF NOT EXISTS idx_post_moderation_history_postId ON post_moderation_history(postId)`,
+		`CREATE INDEX IF NOT EXISTS idx_post_images_imageUrl ON post_images(imageUrl)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_uploads_contentHash ON uploads(contentHash) WHERE contentHash != ''`,
+		`CREATE INDEX IF NOT EXISTS idx_uploads_refCount ON uploads(refCount)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_post_images_cover ON post_images(postId) WHERE isCover = 1`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories(slug) WHERE slug != ''`,
+		`CREATE INDEX IF NOT EXISTS idx_categories_parentId ON categories(parentId)`,
+		`CREATE INDEX IF NOT EXISTS idx_post_attributes_key ON post_attributes(key)`,
+		`CREATE INDEX IF NOT EXISTS idx_posts_rating ON posts(ratingAverage, ratingCount)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_reviews_orderId ON reviews(orderId) WHERE orderId IS NOT NULL`,
 	}
 
-	for _, table := range tables {
-		if _, err := DB.Exec(table); err != nil {
+	for _, index := range indexes {
+		if _, err := DB.Exec(index); err != nil {
 			return fmt.Errorf("error creating table/index: %w", err)
 		}
 	}
 
 	return nil
 }
+
+// createSearchIndex creates the FTS5 index over post name, description and
+// address, kept in sync with the posts table by triggers. The index is an
+// external-content table, so it is backfilled from posts when first created.
+func createSearchIndex() error {
+	var exists int
+	err := DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='posts_fts'`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+			name, description, address,
+			content='posts', content_rowid='id',
+			prefix='2 3',
+			tokenize='unicode61 remove_diacritics 2'
+		)`,
+
+		`CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER INSERT ON posts BEGIN
+			INSERT INTO posts_fts (rowid, name, description, address)
+			VALUES (new.id, new.name, new.description, new.address);
+		END`,
+
+		`CREATE TRIGGER IF NOT EXISTS posts_fts_delete AFTER DELETE ON posts BEGIN
+			INSERT INTO posts_fts (posts_fts, rowid, name, description, address)
+			VALUES ('delete', old.id, old.name, old.description, old.address);
+		END`,
+
+		`CREATE TRIGGER IF NOT EXISTS posts_fts_update AFTER UPDATE OF name, description, address ON posts BEGIN
+			INSERT INTO posts_fts (posts_fts, rowid, name, description, address)
+			VALUES ('delete', old.id, old.name, old.description, old.address);
+			INSERT INTO posts_fts (rowid, name, description, address)
+			VALUES (new.id, new.name, new.description, new.address);
+		END`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := DB.Exec(stmt); err != nil {
+			return fmt.Errorf("error creating search index: %w", err)
+		}
+	}
+
+	if exists == 0 {
+		if _, err := DB.Exec(`INSERT INTO posts_fts (posts_fts) VALUES ('rebuild')`); err != nil {
+			return fmt.Errorf("error backfilling search index: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// createUploadReferences keeps uploads.refCount equal to the number of
+// post_images rows using each upload, including rows removed by cascading
+// post deletes. Counts are backfilled when the triggers are first created.
+func createUploadReferences() error {
+	if err := dropUploadOwnerColumn(); err != nil {
+		return err
+	}
+
+	var exists int
+	err := DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='trigger' AND name='post_images_ref_insert'`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		`CREATE TRIGGER IF NOT EXISTS post_images_ref_insert AFTER INSERT ON post_images BEGIN
+			UPDATE uploads SET refCount = refCount + 1 WHERE url = new.imageUrl;
+		END`,
+
+		`CREATE TRIGGER IF NOT EXISTS post_images_ref_delete AFTER DELETE ON post_images BEGIN
+			UPDATE uploads SET refCount = refCount - 1 WHERE url = old.imageUrl;
+		END`,
+
+		`CREATE TRIGGER IF NOT EXISTS post_images_ref_update AFTER UPDATE OF imageUrl ON post_images BEGIN
+			UPDATE uploads SET refCount = refCount - 1 WHERE url = old.imageUrl;
+			UPDATE uploads SET refCount = refCount + 1 WHERE url = new.imageUrl;
+		END`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := DB.Exec(stmt); err != nil {
+			return fmt.Errorf("error creating upload reference triggers: %w", err)
+		}
+	}
+
+	if exists == 0 {
+		if _, err := DB.Exec(`
+			UPDATE uploads SET refCount = (SELECT COUNT(*) FROM post_images WHERE post_images.imageUrl = uploads.url)`); err != nil {
+			return fmt.Errorf("error backfilling upload references: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// dropUploadOwnerColumn moves the owners recorded in the uploads.userId
+// column of older databases to upload_owners, then rebuilds uploads without
+// the column: SQLite cannot drop a column with a foreign key, and leaving it
+// would keep a reference to users that nothing reads. The reference triggers
+// go with the old table and are recreated, with fresh counts, by
+// createUploadReferences.
+func dropUploadOwnerColumn() error {
+	hasOwnerColumn, err := columnExists("uploads", "userId")
+	if err != nil || !hasOwnerColumn {
+		return err
+	}
+
+	// foreign keys are switched off on one connection so dropping the old
+	// table does not cascade to upload_owners; the pragma has no effect
+	// inside a transaction
+	ctx := context.Background()
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys=OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys=ON")
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	const columns = "id, url, thumbUrl, mediumUrl, largeUrl, mime, width, height, storageKey, contentHash, refCount, dateTime"
+	statements := []string{
+		`INSERT OR IGNORE INTO upload_owners (uploadId, userId, dateTime)
+			SELECT id, userId, dateTime FROM uploads WHERE userId IS NOT NULL`,
+		`DROP TRIGGER IF EXISTS post_images_ref_insert`,
+		`DROP TRIGGER IF EXISTS post_images_ref_delete`,
+		`DROP TRIGGER IF EXISTS post_images_ref_update`,
+		`CREATE TABLE uploads_rebuilt ` + uploadsTable,
+		`INSERT INTO uploads_rebuilt (` + columns + `) SELECT ` + columns + ` FROM uploads`,
+		`DROP TABLE uploads`,
+		`ALTER TABLE uploads_rebuilt RENAME TO uploads`,
+		`CREATE UNIQUE INDEX idx_uploads_contentHash ON uploads(contentHash) WHERE contentHash != ''`,
+		`CREATE INDEX idx_uploads_refCount ON uploads(refCount)`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("error dropping uploads.userId: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// postRatingUpdate recomputes the cached rating of one post (the postId
+// placeholder is filled in per trigger). Reviews without stars are left out.
+const postRatingUpdate = `UPDATE posts SET
+		ratingCount = (SELECT COUNT(*) FROM reviews WHERE reviews.postId = posts.id AND rating > 0),
+		ratingAverage = COALESCE((SELECT ROUND(AVG(rating), 2) FROM reviews WHERE reviews.postId = posts.id AND rating > 0), 0)
+	WHERE id = %s;`
+
+// createRatingAggregates keeps posts.ratingAverage and posts.ratingCount in
+// step with their reviews, including reviews deleted along with their
+// author. Existing posts are counted once, when the triggers are created.
+func createRatingAggregates() error {
+	var exists int
+	err := DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type='trigger' AND name='reviews_rating_insert'`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		`CREATE TRIGGER IF NOT EXISTS reviews_rating_insert AFTER INSERT ON reviews BEGIN
+			` + fmt.Sprintf(postRatingUpdate, "new.postId") + `
+		END`,
+
+		`CREATE TRIGGER IF NOT EXISTS reviews_rating_delete AFTER DELETE ON reviews BEGIN
+			` + fmt.Sprintf(postRatingUpdate, "old.postId") + `
+		END`,
+
+		`CREATE TRIGGER IF NOT EXISTS reviews_rating_update AFTER UPDATE OF rating, postId ON reviews BEGIN
+			` + fmt.Sprintf(postRatingUpdate, "old.postId") + `
+			` + fmt.Sprintf(postRatingUpdate, "new.postId") + `
+		END`,
+	}
+
+	for _, stmt := range statements {
+		if _, err := DB.Exec(stmt); err != nil {
+			return fmt.Errorf("error creating rating triggers: %w", err)
+		}
+	}
+
+	if exists == 0 {
+		if _, err := DB.Exec(fmt.Sprintf(postRatingUpdate, "id")); err != nil {
+			return fmt.Errorf("error backfilling post ratings: %w", err)
+		}
+	}
+	return nil
+}
+
+// createCategoryDeleteGuard stops a category with posts from being deleted.
+// Databases created before posts.categoryId became ON DELETE RESTRICT still
+// cascade, which would delete every post of the category; the trigger runs
+// before that can happen.
+func createCategoryDeleteGuard() error {
+	_, err := DB.Exec(`
+		CREATE TRIGGER IF NOT EXISTS categories_delete_guard BEFORE DELETE ON categories
+		WHEN EXISTS (SELECT 1 FROM posts WHERE posts.categoryId = old.id)
+		BEGIN
+			SELECT RAISE(ABORT, 'category still has posts');
+		END`)
+	if err != nil {
+		return fmt.Errorf("error creating category delete guard: %w", err)
+	}
+	return nil
+}
+
+// ReservedCategorySlugs are the static routes beside /category/:slug, which
+// a category with one of these slugs could not be reached past
+var ReservedCategorySlugs = []string{"tree"}
+
+// backfillCategorySlugs gives categories created before slugs existed a
+// unique slug derived from their name, as well as categories whose slug has
+// since been reserved
+func backfillCategorySlugs() error {
+	rows, err := DB.Query("SELECT id, name, slug FROM categories ORDER BY id")
+	if err != nil {
+		return err
+	}
+	used := map[string]bool{}
+	for _, slug := range ReservedCategorySlugs {
+		used[slug] = true
+	}
+	missing := map[int64]string{}
+	var order []int64
+	for rows.Next() {
+		var id int64
+		var name, slug string
+		if err := rows.Scan(&id, &name, &slug); err != nil {
+			rows.Close()
+			return err
+		}
+		if slug != "" && !slices.Contains(ReservedCategorySlugs, slug) {
+			used[slug] = true
+			continue
+		}
+		missing[id] = name
+		order = append(order, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range order {
+		slug, _ := utils.UniqueSlug(missing[id], "category", func(slug string) (bool, error) {
+			return used[slug], nil
+		})
+		used[slug] = true
+		if _, err := DB.Exec("UPDATE categories SET slug=? WHERE id=?", slug, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumnIfMissing adds a column to an existing table unless it is already there
+func addColumnIfMissing(table, column, definition string) error {
+	exists, err := columnExists(table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("error adding column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// columnExists reports whether a table has a column
+func columnExists(table, column string) (bool, error) {
+	rows, err := DB.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("error reading columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			colType    string
+			notNull    int
+			defaultVal sql.NullString
+			pk         int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultVal, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
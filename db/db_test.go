@@ -0,0 +1,147 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestMain opens a fresh database in a temporary directory, since InitDB
+// opens api.db in the working directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "rentx-db")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := os.Chdir(dir); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Setenv("SUPERADMIN_NAME", "Admin")
+	os.Setenv("SUPERADMIN_EMAIL", "admin@example.com")
+	os.Setenv("SUPERADMIN_PHONE", "0000000000")
+	os.Setenv("SUPERADMIN_PASSWORD", "secret")
+	InitDB()
+
+	code := m.Run()
+	CloseDB()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func refCount(t *testing.T, uploadId int64) int {
+	t.Helper()
+	var n int
+	if err := DB.QueryRow("SELECT refCount FROM uploads WHERE id=?", uploadId).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestUploadReferencesBackfillOnce(t *testing.T) {
+	res, err := DB.Exec(`
+		INSERT INTO uploads (url, thumbUrl, mediumUrl, largeUrl, mime, width, height, refCount)
+		VALUES ('/storage/posts/backfill.png', '', '', '', 'image/png', 1, 1, 7)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadId, _ := res.LastInsertId()
+
+	// the triggers exist, so a restart leaves the counts alone
+	if err := createUploadReferences(); err != nil {
+		t.Fatal(err)
+	}
+	if n := refCount(t, uploadId); n != 7 {
+		t.Errorf("refCount after a restart = %d, want 7", n)
+	}
+
+	// a database from before the triggers gets its counts recomputed
+	for _, trigger := range []string{"post_images_ref_insert", "post_images_ref_delete", "post_images_ref_update"} {
+		if _, err := DB.Exec("DROP TRIGGER " + trigger); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := createUploadReferences(); err != nil {
+		t.Fatal(err)
+	}
+	if n := refCount(t, uploadId); n != 0 {
+		t.Errorf("refCount after the backfill = %d, want 0", n)
+	}
+}
+
+func TestUploadOwnerColumnDropped(t *testing.T) {
+	// the shape uploads had before upload_owners
+	if _, err := DB.Exec("ALTER TABLE uploads ADD COLUMN userId INTEGER REFERENCES users (id) ON DELETE SET NULL"); err != nil {
+		t.Fatal(err)
+	}
+	var userId int64
+	if err := DB.QueryRow("SELECT id FROM users WHERE role='superadmin'").Scan(&userId); err != nil {
+		t.Fatal(err)
+	}
+	res, err := DB.Exec(`
+		INSERT INTO uploads (url, thumbUrl, mediumUrl, largeUrl, mime, width, height, contentHash, userId)
+		VALUES ('/storage/posts/owned.png', '', '', '', 'image/png', 1, 1, 'owned', ?)`, userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadId, _ := res.LastInsertId()
+
+	if err := createUploadReferences(); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists, err := columnExists("uploads", "userId"); err != nil || exists {
+		t.Errorf("uploads.userId exists = %v, %v; want false", exists, err)
+	}
+	var owners int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM upload_owners WHERE uploadId=? AND userId=?", uploadId, userId).Scan(&owners); err != nil {
+		t.Fatal(err)
+	}
+	if owners != 1 {
+		t.Errorf("%d owner rows migrated, want 1", owners)
+	}
+	var objects int
+	err = DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name IN
+		('idx_uploads_contentHash', 'idx_uploads_refCount', 'post_images_ref_insert', 'post_images_ref_delete', 'post_images_ref_update')`).
+		Scan(&objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objects != 5 {
+		t.Errorf("%d of the upload indexes and triggers exist, want 5", objects)
+	}
+
+	// foreign keys are enforced again
+	if _, err := DB.Exec("INSERT INTO upload_owners (uploadId, userId) VALUES (?, ?)", uploadId+1000, userId); err == nil {
+		t.Error("owner of a missing upload was accepted")
+	}
+	if _, err := DB.Exec("DELETE FROM uploads WHERE id=?", uploadId); err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.QueryRow("SELECT COUNT(*) FROM upload_owners WHERE uploadId=?", uploadId).Scan(&owners); err != nil {
+		t.Fatal(err)
+	}
+	if owners != 0 {
+		t.Error("owners were not deleted with their upload")
+	}
+}
+
+func TestBackfillCategorySlugsFreesReservedSlugs(t *testing.T) {
+	res, err := DB.Exec("INSERT INTO categories (name, slug) VALUES ('Tree', 'tree')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+
+	if err := backfillCategorySlugs(); err != nil {
+		t.Fatal(err)
+	}
+	var slug string
+	if err := DB.QueryRow("SELECT slug FROM categories WHERE id=?", id).Scan(&slug); err != nil {
+		t.Fatal(err)
+	}
+	if slug != "tree-2" {
+		t.Errorf("slug = %q, want tree-2", slug)
+	}
+}
@@ -0,0 +1,40 @@
+package filestore
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// FromEnv builds the store selected by STORAGE_DRIVER: "local" (the default)
+// writes under STORAGE_LOCAL_DIR, "s3" writes to the bucket described by the
+// S3_* variables.
+func FromEnv() (Store, error) {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		return NewLocal(envOr("STORAGE_LOCAL_DIR", "storage"), envOr("STORAGE_LOCAL_URL", "/storage")), nil
+	case "s3":
+		pathStyle, err := strconv.ParseBool(envOr("S3_PATH_STYLE", "true"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3_PATH_STYLE: %w", err)
+		}
+		return NewS3(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PublicURL:       os.Getenv("S3_PUBLIC_URL"),
+			PathStyle:       pathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,17 @@
+// Package filestore keeps uploaded files in a pluggable backend: the local
+// filesystem for a single instance, or an S3-compatible bucket shared by
+// every API instance behind a load balancer.
+package filestore
+
+import "context"
+
+// Store writes and removes files by key, e.g. "posts/3f9a.jpg". Keys use
+// forward slashes whatever the backend.
+type Store interface {
+	// Put writes data under key, replacing any existing file
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Delete removes the file under key; deleting a missing file is not an error
+	Delete(ctx context.Context, key string) error
+	// URL is the public address clients fetch the file from
+	URL(key string) string
+}
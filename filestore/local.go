@@ -0,0 +1,55 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local keeps files in a directory that the API serves itself under BaseURL
+type Local struct {
+	Dir     string // e.g. "storage"
+	BaseURL string // e.g. "/storage"
+}
+
+// NewLocal returns a local store rooted at dir and served under baseURL
+func NewLocal(dir, baseURL string) *Local {
+	return &Local{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (l *Local) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (l *Local) URL(key string) string {
+	return l.BaseURL + "/" + key
+}
+
+// path maps a key inside Dir, refusing keys that would escape it
+func (l *Local) path(key string) (string, error) {
+	if !fs.ValidPath(key) {
+		return "", errors.New("invalid file key " + key)
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}
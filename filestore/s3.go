@@ -0,0 +1,132 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config configures an S3-compatible bucket (AWS S3, MinIO, Cloudflare R2, ...)
+type S3Config struct {
+	Endpoint        string // e.g. "https://s3.eu-west-1.amazonaws.com" or "http://localhost:9000"
+	Region          string // defaults to us-east-1
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	// PublicURL is where clients fetch objects, e.g. a CDN in front of the
+	// bucket; defaults to the bucket's own URL, which must allow public reads
+	PublicURL string
+	// PathStyle addresses the bucket as endpoint/bucket instead of bucket.endpoint
+	PathStyle bool
+	// Client sends the requests; nil uses a client with a 30s timeout
+	Client *http.Client
+}
+
+// S3 keeps files in an S3-compatible bucket, so that every API instance
+// sees the same uploads. Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	bucketURL *url.URL
+	publicURL string
+	signer    signer
+	client    *http.Client
+}
+
+// NewS3 validates cfg and returns a store for its bucket
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Bucket == "" || cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("S3 storage needs a bucket, an access key id and a secret access key")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+
+	bucketURL := *endpoint
+	if cfg.PathStyle {
+		bucketURL.Path += "/" + cfg.Bucket
+	} else {
+		bucketURL.Host = cfg.Bucket + "." + bucketURL.Host
+	}
+
+	publicURL := strings.TrimSuffix(cfg.PublicURL, "/")
+	if publicURL == "" {
+		publicURL = bucketURL.String()
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	return &S3{
+		bucketURL: &bucketURL,
+		publicURL: publicURL,
+		signer: signer{
+			accessKeyID:     cfg.AccessKeyID,
+			secretAccessKey: cfg.SecretAccessKey,
+			region:          cfg.Region,
+			service:         "s3",
+		},
+		client: client,
+	}, nil
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	req, err := s.newRequest(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return s.do(req, data)
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	return s.do(req, nil)
+}
+
+func (s *S3) URL(key string) string {
+	return s.publicURL + "/" + uriEncode(key, false)
+}
+
+func (s *S3) newRequest(ctx context.Context, method, key string, data []byte) (*http.Request, error) {
+	objectURL := s.bucketURL.String() + "/" + uriEncode(key, false)
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	return http.NewRequestWithContext(ctx, method, objectURL, body)
+}
+
+// do signs and sends req. S3 answers DELETE of a missing object with 204;
+// some compatible services answer 404, which is treated the same.
+func (s *S3) do(req *http.Request, payload []byte) error {
+	s.signer.sign(req, sha256Hex(payload), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 || (req.Method == http.MethodDelete && resp.StatusCode == http.StatusNotFound) {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("S3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, bytes.TrimSpace(detail))
+}
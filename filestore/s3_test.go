@@ -0,0 +1,108 @@
+package filestore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestS3(t *testing.T, secret string) (*S3, *FakeS3) {
+	t.Helper()
+	cfg := S3Config{
+		Region:          "eu-west-1",
+		Bucket:          "uploads",
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+	}
+	fake := NewFakeS3(cfg)
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+
+	cfg.Endpoint = srv.URL
+	cfg.SecretAccessKey = secret
+	store, err := NewS3(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, fake
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	store, fake := newTestS3(t, "secret")
+	ctx := context.Background()
+	key := "posts/2026/bike photo.png"
+	data := []byte("\x89PNG fake image")
+
+	if err := store.Put(ctx, key, data, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := fake.Object(key); !ok || string(got) != string(data) {
+		t.Fatalf("stored object = %q, %v; want %q", got, ok, data)
+	}
+
+	resp, err := http.Get(store.URL(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != string(data) {
+		t.Fatalf("GET %s = %s %q, want 200 %q", store.URL(key), resp.Status, body, data)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+		t.Errorf("Content-Type = %q, want image/png", ct)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.Object(key); ok {
+		t.Fatal("object still stored after Delete")
+	}
+	resp, err = http.Get(store.URL(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET after Delete = %s, want 404", resp.Status)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("deleting a missing object: %v", err)
+	}
+}
+
+func TestS3RejectsBadSignature(t *testing.T) {
+	store, fake := newTestS3(t, "wrong secret")
+	ctx := context.Background()
+
+	err := store.Put(ctx, "posts/a.png", []byte("data"), "image/png")
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Fatalf("Put with a bad secret = %v, want SignatureDoesNotMatch", err)
+	}
+	if _, ok := fake.Object("posts/a.png"); ok {
+		t.Error("object stored despite the bad signature")
+	}
+	if err := store.Delete(ctx, "posts/a.png"); err == nil {
+		t.Error("Delete with a bad secret succeeded")
+	}
+}
+
+func TestFakeS3RequiresSignedWrites(t *testing.T) {
+	srv := httptest.NewServer(NewFakeS3(S3Config{Bucket: "uploads", AccessKeyID: "id", SecretAccessKey: "secret"}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodPut, srv.URL+"/uploads/a.png", strings.NewReader("data"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("unsigned PUT = %s, want 403", resp.Status)
+	}
+}
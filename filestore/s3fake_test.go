@@ -0,0 +1,137 @@
+package filestore
+
+import (
+	"crypto/hmac"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// FakeS3 is an in-memory stand-in for an S3-compatible service, for testing
+// the S3 store behind httptest.NewServer. It serves path-style PUT, GET and
+// DELETE of objects and checks the Signature Version 4 Authorization header
+// against its credentials: writes must be signed, while unsigned reads are
+// allowed, like a public bucket.
+type FakeS3 struct {
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+}
+
+// NewFakeS3 returns an empty fake serving the bucket described by cfg
+func NewFakeS3(cfg S3Config) *FakeS3 {
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &FakeS3{
+		Bucket:          cfg.Bucket,
+		Region:          region,
+		AccessKeyID:     cfg.AccessKeyID,
+		SecretAccessKey: cfg.SecretAccessKey,
+		objects:         map[string]fakeObject{},
+	}
+}
+
+// Object returns a stored object by key
+func (f *FakeS3) Object(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	obj, ok := f.objects[key]
+	return obj.data, ok
+}
+
+func (f *FakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.Bucket {
+		fakeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	if key == "" {
+		fakeS3Error(w, http.StatusBadRequest, "InvalidRequest")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		fakeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+	signed := r.Header.Get("Authorization") != ""
+	if (signed || r.Method != http.MethodGet && r.Method != http.MethodHead) && !f.authorized(r, body) {
+		fakeS3Error(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[key] = fakeObject{data: body, contentType: r.Header.Get("Content-Type")}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := f.objects[key]
+		if !ok {
+			fakeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fakeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// authorized recomputes the request's signature from the signed headers
+// listed in its Authorization header
+func (f *FakeS3) authorized(r *http.Request, body []byte) bool {
+	auth, ok := strings.CutPrefix(r.Header.Get("Authorization"), sigV4Algorithm+" ")
+	if !ok {
+		return false
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(auth, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		fields[name] = value
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if len(amzDate) != len(amzDateFormat) || payloadHash != sha256Hex(body) {
+		return false
+	}
+
+	s := signer{
+		accessKeyID:     f.AccessKeyID,
+		secretAccessKey: f.SecretAccessKey,
+		region:          f.Region,
+		service:         "s3",
+	}
+	if fields["Credential"] != s.accessKeyID+"/"+s.scope(amzDate) {
+		return false
+	}
+	signature := s.signature(r, r.Host, strings.Split(fields["SignedHeaders"], ";"), payloadHash, amzDate)
+	return hmac.Equal([]byte(signature), []byte(fields["Signature"]))
+}
+
+func fakeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	io.WriteString(w, "<Error><Code>"+code+"</Code></Error>")
+}
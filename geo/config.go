@@ -0,0 +1,22 @@
+package geo
+
+import (
+	"fmt"
+	"os"
+)
+
+// FromEnv builds the geocoder selected by GEOCODER. Only "static" (the
+// default) is built in: it reads GEOCODER_STATIC_FILE, or resolves nothing
+// when no file is configured.
+func FromEnv() (Geocoder, error) {
+	switch driver := os.Getenv("GEOCODER"); driver {
+	case "", "static":
+		path := os.Getenv("GEOCODER_STATIC_FILE")
+		if path == "" {
+			return NewStaticGeocoder(nil), nil
+		}
+		return LoadStaticGeocoder(path)
+	default:
+		return nil, fmt.Errorf("unknown GEOCODER %q", driver)
+	}
+}
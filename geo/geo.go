@@ -0,0 +1,86 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"math"
+)
+
+const earthRadiusKm = 6371.0
+
+// Point is a WGS84 coordinate
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// BBox is a map viewport. MinLng > MaxLng means it crosses the antimeridian.
+type BBox struct {
+	MinLat float64
+	MinLng float64
+	MaxLat float64
+	MaxLng float64
+}
+
+// Geocoder resolves a free-text address to coordinates
+type Geocoder interface {
+	Geocode(ctx context.Context, address string) (Point, error)
+}
+
+// ErrNotFound is returned when a geocoder cannot resolve an address
+var ErrNotFound = errors.New("address not found")
+
+// Valid reports whether the point is a real coordinate
+func (p Point) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// Valid reports whether the box has real coordinates and a positive height
+func (b BBox) Valid() bool {
+	return Point{b.MinLat, b.MinLng}.Valid() && Point{b.MaxLat, b.MaxLng}.Valid() && b.MinLat <= b.MaxLat
+}
+
+// Center is the middle of the box, accounting for antimeridian crossing
+func (b BBox) Center() Point {
+	lng := (b.MinLng + b.MaxLng) / 2
+	if b.MinLng > b.MaxLng {
+		lng += 180
+		if lng > 180 {
+			lng -= 360
+		}
+	}
+	return Point{Lat: (b.MinLat + b.MaxLat) / 2, Lng: lng}
+}
+
+// DistanceKm is the great-circle (haversine) distance between two points
+func DistanceKm(a, b Point) float64 {
+	dLat := radians(b.Lat - a.Lat)
+	dLng := radians(b.Lng - a.Lng)
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(radians(a.Lat))*math.Cos(radians(b.Lat))*math.Pow(math.Sin(dLng/2), 2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// BoundingBox returns a box that contains every point within radiusKm of
+// center, used to narrow a radius search before computing exact distances
+func BoundingBox(center Point, radiusKm float64) BBox {
+	dLat := radiusKm / earthRadiusKm * 180 / math.Pi
+	minLat, maxLat := center.Lat-dLat, center.Lat+dLat
+	if minLat <= -90 || maxLat >= 90 {
+		// a pole is inside the circle: every longitude qualifies
+		return BBox{MinLat: math.Max(minLat, -90), MinLng: -180, MaxLat: math.Min(maxLat, 90), MaxLng: 180}
+	}
+
+	dLng := math.Asin(math.Min(1, math.Sin(radiusKm/earthRadiusKm)/math.Cos(radians(center.Lat)))) * 180 / math.Pi
+	minLng, maxLng := center.Lng-dLng, center.Lng+dLng
+	if minLng < -180 {
+		minLng += 360
+	}
+	if maxLng > 180 {
+		maxLng -= 360
+	}
+	return BBox{MinLat: minLat, MinLng: minLng, MaxLat: maxLat, MaxLng: maxLng}
+}
+
+func radians(deg float64) float64 {
+	return deg * math.Pi / 180
+}
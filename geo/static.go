@@ -0,0 +1,62 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+)
+
+// StaticGeocoder resolves addresses from a fixed table of place names. An
+// address matches the longest place name it contains, so "Road 11, Gulshan,
+// Dhaka" resolves to "gulshan" before "dhaka". It needs no network access.
+type StaticGeocoder struct {
+	places map[string]Point
+}
+
+// NewStaticGeocoder builds a geocoder from place name → coordinate pairs
+func NewStaticGeocoder(places map[string]Point) *StaticGeocoder {
+	g := &StaticGeocoder{places: map[string]Point{}}
+	for name, p := range places {
+		g.places[normalizeAddress(name)] = p
+	}
+	return g
+}
+
+// LoadStaticGeocoder reads a JSON object of place name → {"lat", "lng"}
+func LoadStaticGeocoder(path string) (*StaticGeocoder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var places map[string]Point
+	if err := json.Unmarshal(data, &places); err != nil {
+		return nil, err
+	}
+	return NewStaticGeocoder(places), nil
+}
+
+func (g *StaticGeocoder) Geocode(_ context.Context, address string) (Point, error) {
+	address = normalizeAddress(address)
+	if p, ok := g.places[address]; ok {
+		return p, nil
+	}
+
+	best := ""
+	for name := range g.places {
+		if len(name) > len(best) && strings.Contains(" "+address+" ", " "+name+" ") {
+			best = name
+		}
+	}
+	if best == "" {
+		return Point{}, ErrNotFound
+	}
+	return g.places[best], nil
+}
+
+// normalizeAddress lowercases and reduces punctuation to single spaces
+func normalizeAddress(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return r == ' ' || r == ',' || r == '.' || r == ';' || r == '\t' || r == '\n'
+	}), " ")
+}
@@ -0,0 +1,57 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStaticGeocoder(t *testing.T) {
+	dhaka := Point{Lat: 23.8103, Lng: 90.4125}
+	gulshan := Point{Lat: 23.7925, Lng: 90.4078}
+	uttara := Point{Lat: 23.8759, Lng: 90.3795}
+	g := NewStaticGeocoder(map[string]Point{"Dhaka": dhaka, "Gulshan": gulshan, "Uttara Sector 4": uttara})
+
+	for _, c := range []struct {
+		address string
+		want    Point
+		err     error
+	}{
+		{"Dhaka", dhaka, nil},
+		{"  DHAKA. ", dhaka, nil},
+		{"Road 11, Gulshan, Dhaka", gulshan, nil},
+		{"House 5; uttara  sector 4\tDhaka", uttara, nil},
+		{"Uttara Sector 40, Dhaka", dhaka, nil}, // whole words only
+		{"Gulshanabad", Point{}, ErrNotFound},
+		{"", Point{}, ErrNotFound},
+	} {
+		got, err := g.Geocode(context.Background(), c.address)
+		if !errors.Is(err, c.err) || got != c.want {
+			t.Errorf("Geocode(%q) = %v, %v, want %v, %v", c.address, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestLoadStaticGeocoder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "places.json")
+	if err := os.WriteFile(path, []byte(`{"Banani": {"lat": 23.7937, "lng": 90.4066}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	g, err := LoadStaticGeocoder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := g.Geocode(context.Background(), "Road 27, Banani")
+	if want := (Point{Lat: 23.7937, Lng: 90.4066}); err != nil || got != want {
+		t.Errorf("Geocode = %v, %v, want %v", got, err, want)
+	}
+
+	if err := os.WriteFile(path, []byte(`not json`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadStaticGeocoder(path); err == nil {
+		t.Error("LoadStaticGeocoder of invalid JSON: no error")
+	}
+}
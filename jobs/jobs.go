@@ -0,0 +1,54 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"rentx/models"
+	"time"
+)
+
+// StartICalSync re-syncs external iCalendar feeds in the background every
+// ICAL_SYNC_INTERVAL (default 1h)
+func StartICalSync() {
+	interval := durationFromEnv("ICAL_SYNC_INTERVAL", time.Hour)
+	go every(interval, "iCal sync", models.SyncAllICalImports)
+}
+
+// StartUploadSweep deletes uploaded images no post uses once they are older
+// than UPLOAD_TTL (default 24h), checking every UPLOAD_SWEEP_INTERVAL (default 1h)
+func StartUploadSweep() {
+	interval := durationFromEnv("UPLOAD_SWEEP_INTERVAL", time.Hour)
+	ttl := durationFromEnv("UPLOAD_TTL", 24*time.Hour)
+	go every(interval, "upload sweep", func() error {
+		removed, err := models.SweepOrphanedUploads(ttl)
+		if removed > 0 {
+			fmt.Printf("✅ Removed %d unused uploads\n", removed)
+		}
+		return err
+	})
+}
+
+// every runs fn on a fixed interval for the lifetime of the process
+func every(interval time.Duration, name string, fn func() error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := fn(); err != nil {
+			fmt.Printf("⚠️  %s: %v\n", name, err)
+		}
+	}
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		fmt.Printf("⚠️  Invalid %s %q, using %s\n", key, value, fallback)
+		return fallback
+	}
+	return d
+}
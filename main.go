@@ -2,7 +2,12 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"rentx/db"
+	"rentx/filestore"
+	"rentx/geo"
+	"rentx/jobs"
+	"rentx/models"
 	"rentx/routes"
 	"time"
 
@@ -18,6 +23,21 @@ func main() {
 
 	db.InitDB()
 	defer db.CloseDB()
+
+	geocoder, err := geo.FromEnv()
+	if err != nil {
+		log.Fatal("Geocoder could not be configured: ", err)
+	}
+	models.PostGeocoder = geocoder
+
+	store, err := filestore.FromEnv()
+	if err != nil {
+		log.Fatal("File storage could not be configured: ", err)
+	}
+	models.FileStore = store
+
+	jobs.StartICalSync()
+	jobs.StartUploadSweep()
 	server := gin.Default()
 
 	server.Use(cors.New(cors.Config{
@@ -29,7 +49,10 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
-	server.Static("/storage", "./storage")
+	// Local uploads are served by the API itself; S3 ones straight from the bucket
+	if local, ok := store.(*filestore.Local); ok {
+		server.Static(local.BaseURL, local.Dir)
+	}
 
 	routes.RegisterRoutes(server)
 	server.Run(":8080")
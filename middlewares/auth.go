@@ -29,3 +29,14 @@ func Authenticate(c *gin.Context) {
 
 	c.Next()
 }
+
+// OptionalAuthenticate identifies the caller when a token is sent, for
+// public routes that show more to owners and admins. A missing token is
+// fine; an invalid one is still rejected.
+func OptionalAuthenticate(c *gin.Context) {
+	if c.GetHeader("Authorization") == "" {
+		c.Next()
+		return
+	}
+	Authenticate(c)
+}
@@ -0,0 +1,233 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"rentx/db"
+	"rentx/utils"
+	"time"
+)
+
+// Blackout is an owner-defined range of dates (inclusive) when a post cannot be booked
+type Blackout struct {
+	Id        int64  `json:"id"`
+	PostId    int64  `json:"postId"`
+	StartDate string `json:"startDate" binding:"required"` // YYYY-MM-DD
+	EndDate   string `json:"endDate" binding:"required"`   // YYYY-MM-DD, inclusive
+	Reason    string `json:"reason"`
+	Source    string `json:"source"` // 'manual' | 'ical-url' | 'ical-upload'
+	DateTime  string `json:"dateTime"`
+}
+
+// Calendar day statuses
+const (
+	DayAvailable = "available"
+	DayBooked    = "booked"
+	DayBlocked   = "blocked"
+)
+
+// CalendarDay is the availability of a post on one date
+type CalendarDay struct {
+	Date   string `json:"date"`
+	Status string `json:"status"`
+}
+
+// CalendarRange is a run of consecutive unavailable days with the same status
+type CalendarRange struct {
+	StartDate string `json:"startDate"`
+	EndDate   string `json:"endDate"`
+	Status    string `json:"status"`
+}
+
+// Calendar is the availability of a post for one month
+type Calendar struct {
+	PostId int64           `json:"postId"`
+	Month  string          `json:"month"` // YYYY-MM
+	Ranges []CalendarRange `json:"ranges"`
+	Days   []CalendarDay   `json:"days"`
+}
+
+// MaxBlackoutDays is the longest range of dates that can be blocked at once
+const MaxBlackoutDays = 2 * MaxRentalDays
+
+var (
+	ErrDatesBlocked     = errors.New("post is unavailable for some of the requested dates")
+	ErrBlackoutNotFound = errors.New("blocked range not found")
+)
+
+// Save validates and inserts a blocked range. Ranges overlapping a live
+// booking are rejected; the owner has to decline or cancel it first.
+func (b *Blackout) Save() error {
+	start, end, err := utils.ParseDateRange(b.StartDate, b.EndDate)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDates, err)
+	}
+	if utils.DayCount(start, end) > MaxBlackoutDays {
+		return fmt.Errorf("%w: a blocked range cannot be longer than %d days", ErrInvalidDates, MaxBlackoutDays)
+	}
+	b.StartDate = start.Format(utils.DateLayout)
+	b.EndDate = end.Format(utils.DateLayout)
+	b.Source = BlackoutManual
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	booked, err := hasBookingOverlap(tx, b.PostId, b.StartDate, b.EndDate)
+	if err != nil {
+		return err
+	}
+	if booked {
+		return ErrBookingConflict
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO post_blackouts (postId, startDate, endDate, reason, source) VALUES (?, ?, ?, ?, ?)`,
+		b.PostId, b.StartDate, b.EndDate, b.Reason, b.Source)
+	if err != nil {
+		return err
+	}
+	b.Id, _ = res.LastInsertId()
+
+	return tx.Commit()
+}
+
+// Delete removes a blocked range from its post
+func (b *Blackout) Delete() error {
+	res, err := db.DB.Exec("DELETE FROM post_blackouts WHERE id=? AND postId=?", b.Id, b.PostId)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrBlackoutNotFound
+	}
+	return nil
+}
+
+// ListBlackouts returns the blocked ranges of a post ordered by start date
+func ListBlackouts(postId int64) ([]Blackout, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, postId, startDate, endDate, reason, source, dateTime
+		FROM post_blackouts WHERE postId=? ORDER BY startDate ASC`, postId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blackouts := []Blackout{}
+	for rows.Next() {
+		var b Blackout
+		if err := rows.Scan(&b.Id, &b.PostId, &b.StartDate, &b.EndDate, &b.Reason, &b.Source, &b.DateTime); err != nil {
+			return nil, err
+		}
+		blackouts = append(blackouts, b)
+	}
+	return blackouts, nil
+}
+
+// GetPostCalendar merges bookings and blocked ranges of a post into a
+// per-day calendar for the given month (YYYY-MM)
+func GetPostCalendar(postId int64, month string) (*Calendar, error) {
+	first, err := time.Parse("2006-01", month)
+	if err != nil {
+		return nil, fmt.Errorf("%w: month must be formatted as YYYY-MM", ErrInvalidDates)
+	}
+	last := first.AddDate(0, 1, -1)
+	from := first.Format(utils.DateLayout)
+	to := last.Format(utils.DateLayout)
+
+	if _, err := GetPostStatus(postId); err != nil {
+		return nil, err
+	}
+
+	statuses := map[string]string{}
+	mark := func(query string, status string, args ...interface{}) error {
+		rows, err := db.DB.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var startDate, endDate string
+			if err := rows.Scan(&startDate, &endDate); err != nil {
+				return err
+			}
+			start, end, err := utils.ParseDateRange(startDate, endDate)
+			if err != nil {
+				continue // legacy rows without dates
+			}
+			// only the days of the month matter, however long the range
+			if start.Before(first) {
+				start = first
+			}
+			if end.After(last) {
+				end = last
+			}
+			for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+				statuses[d.Format(utils.DateLayout)] = status
+			}
+		}
+		return rows.Err()
+	}
+
+	// blocked first so that a booking on the same day wins
+	if err := mark(`
+		SELECT startDate, endDate FROM post_blackouts
+		WHERE postId=? AND startDate <= ? AND endDate >= ?`,
+		DayBlocked, postId, to, from); err != nil {
+		return nil, err
+	}
+	if err := mark(`
+		SELECT startDate, endDate FROM orders
+		WHERE postId=? AND startDate <= ? AND endDate >= ? AND status NOT IN (?, ?)`,
+		DayBooked, postId, to, from, OrderDeclined, OrderCancelled); err != nil {
+		return nil, err
+	}
+
+	cal := &Calendar{PostId: postId, Month: first.Format("2006-01"), Ranges: []CalendarRange{}, Days: []CalendarDay{}}
+	for d := first; !d.After(last); d = d.AddDate(0, 0, 1) {
+		date := d.Format(utils.DateLayout)
+		status, ok := statuses[date]
+		if !ok {
+			status = DayAvailable
+		}
+		cal.Days = append(cal.Days, CalendarDay{Date: date, Status: status})
+
+		if status == DayAvailable {
+			continue
+		}
+		if n := len(cal.Ranges); n > 0 && cal.Ranges[n-1].Status == status &&
+			cal.Ranges[n-1].EndDate == d.AddDate(0, 0, -1).Format(utils.DateLayout) {
+			cal.Ranges[n-1].EndDate = date
+			continue
+		}
+		cal.Ranges = append(cal.Ranges, CalendarRange{StartDate: date, EndDate: date, Status: status})
+	}
+
+	return cal, nil
+}
+
+// hasBookingOverlap reports whether a live order of the post overlaps the range
+func hasBookingOverlap(tx *sql.Tx, postId int64, startDate, endDate string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`
+		SELECT COUNT(*) FROM orders
+		WHERE postId=? AND startDate <= ? AND endDate >= ? AND status NOT IN (?, ?)`,
+		postId, endDate, startDate, OrderDeclined, OrderCancelled).Scan(&count)
+	return count > 0, err
+}
+
+// hasBlackoutOverlap reports whether a blocked range of the post overlaps the range
+func hasBlackoutOverlap(tx *sql.Tx, postId int64, startDate, endDate string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`
+		SELECT COUNT(*) FROM post_blackouts
+		WHERE postId=? AND startDate <= ? AND endDate >= ?`,
+		postId, endDate, startDate).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"errors"
+	"rentx/db"
+	"testing"
+)
+
+func TestBlackoutSaveRejectsLongRanges(t *testing.T) {
+	post := newTestPost(t, newTestUser(t))
+
+	b := &Blackout{PostId: post.Id, StartDate: "0001-01-01", EndDate: "9999-12-31"}
+	if err := b.Save(); !errors.Is(err, ErrInvalidDates) {
+		t.Errorf("Save() = %v, want ErrInvalidDates", err)
+	}
+	b = &Blackout{PostId: post.Id, StartDate: "2027-01-01", EndDate: "2028-12-30"}
+	if err := b.Save(); err != nil {
+		t.Errorf("Save() of %d days = %v", MaxBlackoutDays, err)
+	}
+}
+
+func TestGetPostCalendarClampsRanges(t *testing.T) {
+	post := newTestPost(t, newTestUser(t))
+	// stored before ranges were capped
+	_, err := db.DB.Exec(`
+		INSERT INTO post_blackouts (postId, startDate, endDate, reason, source) VALUES (?, '0001-01-01', '2026-11-03', '', ?)`,
+		post.Id, BlackoutManual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.DB.Exec(`
+		INSERT INTO orders (userId, postId, startDate, endDate, status) VALUES (?, ?, '2026-11-28', '2027-02-01', ?)`,
+		newTestUser(t), post.Id, OrderAccepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cal, err := GetPostCalendar(post.Id, "2026-11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cal.Days) != 30 {
+		t.Fatalf("got %d days, want 30", len(cal.Days))
+	}
+	want := []CalendarRange{
+		{StartDate: "2026-11-01", EndDate: "2026-11-03", Status: DayBlocked},
+		{StartDate: "2026-11-28", EndDate: "2026-11-30", Status: DayBooked},
+	}
+	if len(cal.Ranges) != len(want) {
+		t.Fatalf("ranges = %v, want %v", cal.Ranges, want)
+	}
+	for i := range want {
+		if cal.Ranges[i] != want[i] {
+			t.Errorf("range %d = %v, want %v", i, cal.Ranges[i], want[i])
+		}
+	}
+}
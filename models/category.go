@@ -1,30 +1,81 @@
 package models
 
 import (
+	"database/sql"
 	"errors"
+	"fmt"
 	"rentx/db"
+	"rentx/utils"
+	"slices"
 )
 
+// Category is a node of the category tree, e.g. Vehicles → Cars → Vans.
+// Slug identifies it in URLs; it is derived from the name unless given.
 type Category struct {
-	Id     int64  `json:"id"`
-	UserId int64  `json:"-"`
-	Name   string `json:"name" binding:"required"`
+	Id       int64  `json:"id"`
+	ParentId *int64 `json:"parentId"` // nil for top-level categories
+	Name     string `json:"name" binding:"required"`
+	Slug     string `json:"slug"`
+	// ParentSet tells Update that ParentId was given, so that a nil ParentId
+	// moves the category to the top level instead of keeping its parent
+	ParentSet bool `json:"-"`
+}
+
+// CategoryNode is a category with its subcategories and approved post counts
+type CategoryNode struct {
+	Category
+	PostCount       int             `json:"postCount"`       // approved posts here and in all subcategories
+	DirectPostCount int             `json:"directPostCount"` // approved posts filed directly under this category
+	Children        []*CategoryNode `json:"children"`
 }
 
 // Authorization error
 var ErrUnauthorized = errors.New("unauthorized action")
 
-// ---------- Category Methods ----------
+var (
+	ErrCategoryNotFound  = errors.New("category not found")
+	ErrInvalidCategory   = errors.New("invalid category")
+	ErrCategorySlugTaken = errors.New("category slug is already in use")
+	ErrCategoryInUse     = errors.New("category is in use")
+)
+
+// CategoryMove reports what a merge or reassignment moved
+type CategoryMove struct {
+	MovedPosts         int64 `json:"movedPosts"`
+	MovedSubcategories int64 `json:"movedSubcategories"`
+	// DroppedAttributes counts the post attribute values the new categories
+	// do not accept (see dropRejectedAttributes)
+	DroppedAttributes int64 `json:"droppedAttributes"`
+}
+
+// categorySubtreeIds selects the id of the given category and of all its
+// descendants. UNION stops at categories already visited.
+const categorySubtreeIds = `
+	WITH RECURSIVE subtree(id) AS (
+		SELECT ?
+		UNION
+		SELECT categories.id FROM categories JOIN subtree ON categories.parentId = subtree.id
+	)
+	SELECT id FROM subtree`
+
+// ---------- Category Methods (admin only, enforced by the routes) ----------
 
 func (c *Category) Save() error {
-	query := "INSERT INTO categories (name) VALUES (?)"
+	if err := c.checkParent(); err != nil {
+		return err
+	}
+	if err := c.resolveSlug(); err != nil {
+		return err
+	}
+
+	query := "INSERT INTO categories (parentId, name, slug) VALUES (?, ?, ?)"
 	stmt, err := db.DB.Prepare(query)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
-	res, err := stmt.Exec(c.Name)
+	res, err := stmt.Exec(c.ParentId, c.Name, c.Slug)
 	if err != nil {
 		return err
 	}
@@ -32,26 +83,259 @@ func (c *Category) Save() error {
 	return nil
 }
 
-func (c *Category) Update(userId int64) error {
-	if c.UserId != userId {
-		return ErrUnauthorized
+// Update renames and/or moves a category. Without a slug the current one is
+// kept, so existing links keep working; without ParentSet the category stays
+// where it is.
+func (c *Category) Update() error {
+	current, err := getCategory(c.Id)
+	if err != nil {
+		return err
+	}
+	if c.Slug == "" {
+		c.Slug = current.Slug
+	}
+	if !c.ParentSet {
+		c.ParentId = current.ParentId
+	}
+	if err := c.checkParent(); err != nil {
+		return err
+	}
+	if err := c.resolveSlug(); err != nil {
+		return err
 	}
-	query := "UPDATE categories SET name = ? WHERE id = ?"
-	_, err := db.DB.Exec(query, c.Name, c.Id)
+
+	query := "UPDATE categories SET parentId = ?, name = ?, slug = ? WHERE id = ?"
+	_, err = db.DB.Exec(query, c.ParentId, c.Name, c.Slug, c.Id)
 	return err
 }
 
-func (c *Category) Delete(userId int64) error {
-	if c.UserId != userId {
-		return ErrUnauthorized
+// Delete removes a category that has neither posts nor subcategories; move
+// them first with MergeCategory or ReassignCategoryPosts
+func (c *Category) Delete() error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
 	}
-	query := "DELETE FROM categories WHERE id = ?"
-	_, err := db.DB.Exec(query, c.Id)
-	return err
+	defer tx.Rollback()
+
+	var exists bool
+	var posts, children int
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM categories WHERE id=?),
+			(SELECT COUNT(*) FROM posts WHERE categoryId=?),
+			(SELECT COUNT(*) FROM categories WHERE parentId=?)`,
+		c.Id, c.Id, c.Id).Scan(&exists, &posts, &children)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !exists:
+		return ErrCategoryNotFound
+	case posts > 0:
+		return fmt.Errorf("%w: it has %d posts; merge it or reassign them first", ErrCategoryInUse, posts)
+	case children > 0:
+		return fmt.Errorf("%w: it has %d subcategories; merge it or move them first", ErrCategoryInUse, children)
+	}
+
+	if _, err := tx.Exec("DELETE FROM categories WHERE id = ?", c.Id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MergeCategory moves the posts and subcategories of a category into another
+// one and deletes it, in one transaction. The target cannot be the category
+// itself or one of its subcategories. Posts moved along, directly or in a
+// subcategory, lose the attribute values their new category does not accept.
+func MergeCategory(sourceId, targetId int64) (*CategoryMove, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkCategoryMove(tx, sourceId, targetId); err != nil {
+		return nil, err
+	}
+	var inSubtree bool
+	if err := tx.QueryRow("SELECT ? IN ("+categorySubtreeIds+")", targetId, sourceId).Scan(&inSubtree); err != nil {
+		return nil, err
+	}
+	if inSubtree {
+		return nil, fmt.Errorf("%w: cannot merge a category into one of its subcategories", ErrInvalidCategory)
+	}
+
+	// the subcategories inherit the target's attributes instead of the source's
+	affected, err := categorySubtree(tx, sourceId)
+	if err != nil {
+		return nil, err
+	}
+	affected[0] = targetId
+
+	move, err := moveCategoryPosts(tx, sourceId, targetId)
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec("UPDATE categories SET parentId=? WHERE parentId=?", targetId, sourceId)
+	if err != nil {
+		return nil, err
+	}
+	move.MovedSubcategories, _ = res.RowsAffected()
+
+	if _, err := tx.Exec("DELETE FROM categories WHERE id=?", sourceId); err != nil {
+		return nil, err
+	}
+	if move.DroppedAttributes, err = dropRejectedAttributes(tx, affected...); err != nil {
+		return nil, err
+	}
+	return move, tx.Commit()
+}
+
+// ReassignCategoryPosts moves every post filed directly under a category to
+// another one; the category and its subcategories stay. The moved posts lose
+// the attribute values the target does not accept.
+func ReassignCategoryPosts(sourceId, targetId int64) (*CategoryMove, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkCategoryMove(tx, sourceId, targetId); err != nil {
+		return nil, err
+	}
+	move, err := moveCategoryPosts(tx, sourceId, targetId)
+	if err != nil {
+		return nil, err
+	}
+	if move.DroppedAttributes, err = dropRejectedAttributes(tx, targetId); err != nil {
+		return nil, err
+	}
+	return move, tx.Commit()
+}
+
+func checkCategoryMove(tx *sql.Tx, sourceId, targetId int64) error {
+	if sourceId == targetId {
+		return fmt.Errorf("%w: source and target are the same category", ErrInvalidCategory)
+	}
+	var found int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM categories WHERE id IN (?, ?)", sourceId, targetId).Scan(&found); err != nil {
+		return err
+	}
+	if found != 2 {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
+
+func moveCategoryPosts(tx *sql.Tx, sourceId, targetId int64) (*CategoryMove, error) {
+	res, err := tx.Exec("UPDATE posts SET categoryId=? WHERE categoryId=?", targetId, sourceId)
+	if err != nil {
+		return nil, err
+	}
+	move := &CategoryMove{}
+	move.MovedPosts, _ = res.RowsAffected()
+	return move, nil
+}
+
+// categorySubtree returns the id of a category followed by those of all its
+// descendants
+func categorySubtree(q queryer, categoryId int64) ([]int64, error) {
+	rows, err := q.Query(categorySubtreeIds, categoryId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// checkParent makes sure the parent exists and is not the category itself or
+// one of its descendants, which would make a cycle
+func (c *Category) checkParent() error {
+	if c.ParentId == nil {
+		return nil
+	}
+	if _, err := getCategory(*c.ParentId); err != nil {
+		if errors.Is(err, ErrCategoryNotFound) {
+			return fmt.Errorf("%w: parent category not found", ErrInvalidCategory)
+		}
+		return err
+	}
+	if c.Id == 0 {
+		return nil
+	}
+
+	var inSubtree bool
+	err := db.DB.QueryRow("SELECT ? IN ("+categorySubtreeIds+")", *c.ParentId, c.Id).Scan(&inSubtree)
+	if err != nil {
+		return err
+	}
+	if inSubtree {
+		return fmt.Errorf("%w: a category cannot be moved under itself or its subcategories", ErrInvalidCategory)
+	}
+	return nil
+}
+
+// resolveSlug checks a given slug, or derives a free one from the name
+func (c *Category) resolveSlug() error {
+	if c.Slug == "" {
+		slug, err := utils.UniqueSlug(c.Name, "category", func(slug string) (bool, error) {
+			return categorySlugTaken(slug, c.Id)
+		})
+		c.Slug = slug
+		return err
+	}
+
+	if utils.Slugify(c.Slug) != c.Slug {
+		return fmt.Errorf("%w: slug must be lower-case letters and digits separated by dashes", ErrInvalidCategory)
+	}
+	if slices.Contains(db.ReservedCategorySlugs, c.Slug) {
+		return fmt.Errorf("%w: slug %q is reserved", ErrInvalidCategory, c.Slug)
+	}
+	taken, err := categorySlugTaken(c.Slug, c.Id)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrCategorySlugTaken
+	}
+	return nil
+}
+
+// categorySlugTaken reports whether another category, or a route, uses slug
+func categorySlugTaken(slug string, exceptId int64) (bool, error) {
+	if slices.Contains(db.ReservedCategorySlugs, slug) {
+		return true, nil
+	}
+	var taken bool
+	err := db.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM categories WHERE slug=? AND id!=?)", slug, exceptId).Scan(&taken)
+	return taken, err
+}
+
+func getCategory(id int64) (*Category, error) {
+	var c Category
+	err := db.DB.QueryRow("SELECT id, parentId, name, slug FROM categories WHERE id=?", id).
+		Scan(&c.Id, &c.ParentId, &c.Name, &c.Slug)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
 }
 
 func GetCategories() ([]Category, error) {
-	rows, err := db.DB.Query("SELECT id, name FROM categories")
+	rows, err := db.DB.Query("SELECT id, parentId, name, slug FROM categories")
 	if err != nil {
 		return nil, err
 	}
@@ -60,10 +344,83 @@ func GetCategories() ([]Category, error) {
 	var categories []Category
 	for rows.Next() {
 		var c Category
-		if err := rows.Scan(&c.Id, &c.Name); err != nil {
+		if err := rows.Scan(&c.Id, &c.ParentId, &c.Name, &c.Slug); err != nil {
 			return nil, err
 		}
 		categories = append(categories, c)
 	}
 	return categories, nil
 }
+
+// GetCategoryTree returns the top-level categories with their subcategories,
+// sorted by name, each with its approved post counts
+func GetCategoryTree() ([]*CategoryNode, error) {
+	roots, _, err := loadCategoryTree()
+	return roots, err
+}
+
+// GetCategoryBySlug returns one category with its subcategories and counts
+func GetCategoryBySlug(slug string) (*CategoryNode, error) {
+	_, nodes, err := loadCategoryTree()
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		if node.Slug == slug {
+			return node, nil
+		}
+	}
+	return nil, ErrCategoryNotFound
+}
+
+// loadCategoryTree builds the whole tree in one query; categories are few
+// compared to posts, and counting per category lets the sums roll up in Go
+func loadCategoryTree() ([]*CategoryNode, map[int64]*CategoryNode, error) {
+	rows, err := db.DB.Query(`
+		SELECT c.id, c.parentId, c.name, c.slug, COUNT(p.id)
+		FROM categories c
+		LEFT JOIN posts p ON p.categoryId = c.id AND p.status = 'approved'
+		GROUP BY c.id
+		ORDER BY c.name COLLATE NOCASE, c.id`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	nodes := map[int64]*CategoryNode{}
+	var ordered []*CategoryNode
+	for rows.Next() {
+		n := &CategoryNode{Children: []*CategoryNode{}}
+		if err := rows.Scan(&n.Id, &n.ParentId, &n.Name, &n.Slug, &n.DirectPostCount); err != nil {
+			return nil, nil, err
+		}
+		nodes[n.Id] = n
+		ordered = append(ordered, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	roots := []*CategoryNode{}
+	for _, n := range ordered {
+		if n.ParentId != nil {
+			if parent, ok := nodes[*n.ParentId]; ok {
+				parent.Children = append(parent.Children, n)
+				continue
+			}
+		}
+		roots = append(roots, n)
+	}
+	for _, root := range roots {
+		sumPostCounts(root)
+	}
+	return roots, nodes, nil
+}
+
+func sumPostCounts(n *CategoryNode) int {
+	n.PostCount = n.DirectPostCount
+	for _, child := range n.Children {
+		n.PostCount += sumPostCounts(child)
+	}
+	return n.PostCount
+}
@@ -0,0 +1,312 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"rentx/db"
+	"strings"
+)
+
+// Category attribute types
+const (
+	AttributeEnum    = "enum"    // one of Options
+	AttributeNumber  = "number"  // optionally with a Unit and Min/Max
+	AttributeBoolean = "boolean" // true or false
+	AttributeText    = "text"    // free text up to maxAttributeTextLength
+)
+
+// Limits on attribute definitions and values
+const (
+	maxAttributeKeyLength   = 40
+	maxAttributeLabelLength = 100
+	maxAttributeOptions     = 100
+	maxAttributeTextLength  = 200
+	// maxCategoryDepth bounds the walk up the category tree; cycles cannot be
+	// created (see checkParent), so it only matters for corrupt data
+	maxCategoryDepth = 32
+)
+
+var (
+	ErrAttributeNotFound = errors.New("category attribute not found")
+	ErrInvalidAttribute  = errors.New("invalid category attribute")
+	ErrAttributeKeyTaken = errors.New("the category already has an attribute with this key")
+)
+
+// CategoryAttribute is a typed field that posts of a category fill in, e.g.
+// seats (number), fuel (enum) or automatic (boolean). Subcategories inherit
+// the attributes of their ancestors and may redefine one by reusing its key.
+type CategoryAttribute struct {
+	Id         int64    `json:"id"`
+	CategoryId int64    `json:"categoryId"` // where it is defined; an ancestor for inherited attributes
+	Key        string   `json:"key"`
+	Label      string   `json:"label"`
+	Type       string   `json:"type"`
+	Unit       string   `json:"unit"`    // numbers only, e.g. "km"
+	Options    []string `json:"options"` // enums only: the allowed values
+	Min        *float64 `json:"min"`     // numbers only; nil for no limit
+	Max        *float64 `json:"max"`
+	Required   bool     `json:"required"`
+	Position   int      `json:"position"` // display order within its category
+}
+
+// categoryAttributeColumns are the columns scanned by scanCategoryAttribute
+const categoryAttributeColumns = `category_attributes.id, category_attributes.categoryId, category_attributes.key,
+	category_attributes.label, category_attributes.type, category_attributes.unit, category_attributes.options,
+	category_attributes.minValue, category_attributes.maxValue, category_attributes.required, category_attributes.position`
+
+func scanCategoryAttribute(row rowScanner, a *CategoryAttribute, extra ...interface{}) error {
+	var options string
+	dest := []interface{}{&a.Id, &a.CategoryId, &a.Key, &a.Label, &a.Type, &a.Unit, &options,
+		&a.Min, &a.Max, &a.Required, &a.Position}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	a.Options = []string{}
+	return json.Unmarshal([]byte(options), &a.Options)
+}
+
+// ---------- Category Attribute Methods (admin only, enforced by the routes) ----------
+
+// Save adds an attribute to a category. Posts already in the category keep
+// their values; a new required attribute is asked for on their next edit.
+func (a *CategoryAttribute) Save() error {
+	if err := a.normalize(); err != nil {
+		return err
+	}
+	if _, err := getCategory(a.CategoryId); err != nil {
+		return err
+	}
+
+	var taken bool
+	err := db.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM category_attributes WHERE categoryId=? AND key=?)",
+		a.CategoryId, a.Key).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrAttributeKeyTaken
+	}
+
+	options, _ := json.Marshal(a.Options)
+	res, err := db.DB.Exec(`
+		INSERT INTO category_attributes (categoryId, key, label, type, unit, options, minValue, maxValue, required, position)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.CategoryId, a.Key, a.Label, a.Type, a.Unit, string(options), a.Min, a.Max, a.Required, a.Position)
+	if err != nil {
+		return err
+	}
+	a.Id, _ = res.LastInsertId()
+	return nil
+}
+
+// Update changes the definition of an attribute, found by CategoryId and Key.
+// The type cannot change, since stored values would no longer match it.
+func (a *CategoryAttribute) Update() error {
+	current, err := getCategoryAttribute(a.CategoryId, a.Key)
+	if err != nil {
+		return err
+	}
+	if a.Type == "" {
+		a.Type = current.Type
+	}
+	if a.Type != current.Type {
+		return fmt.Errorf("%w: the type of an attribute cannot be changed; delete it and add it again", ErrInvalidAttribute)
+	}
+	if err := a.normalize(); err != nil {
+		return err
+	}
+
+	options, _ := json.Marshal(a.Options)
+	_, err = db.DB.Exec(`
+		UPDATE category_attributes SET label=?, unit=?, options=?, minValue=?, maxValue=?, required=?, position=?
+		WHERE id=?`,
+		a.Label, a.Unit, string(options), a.Min, a.Max, a.Required, a.Position, current.Id)
+	a.Id = current.Id
+	return err
+}
+
+// DeleteCategoryAttribute removes an attribute from a category together with
+// the values posts gave it, except in subcategories that still have an
+// attribute with the same key (their own or an ancestor's)
+func DeleteCategoryAttribute(categoryId int64, key string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM category_attributes WHERE categoryId=? AND key=?", categoryId, key)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAttributeNotFound
+	}
+
+	subtree, err := categorySubtree(tx, categoryId)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range subtree {
+		schema, err := categoryAttributes(tx, id)
+		if err != nil {
+			return err
+		}
+		if findAttribute(schema, key) != nil {
+			continue
+		}
+		_, err = tx.Exec("DELETE FROM post_attributes WHERE key=? AND postId IN (SELECT id FROM posts WHERE categoryId=?)", key, id)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetCategoryAttributes returns the attributes posts of a category fill in:
+// those of its ancestors first, then its own, each in position order
+func GetCategoryAttributes(categoryId int64) ([]CategoryAttribute, error) {
+	if _, err := getCategory(categoryId); err != nil {
+		return nil, err
+	}
+	return categoryAttributes(db.DB, categoryId)
+}
+
+// GetCategoryAttributesBySlug is GetCategoryAttributes for a category slug
+func GetCategoryAttributesBySlug(slug string) ([]CategoryAttribute, error) {
+	var id int64
+	err := db.DB.QueryRow("SELECT id FROM categories WHERE slug=?", slug).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+	return categoryAttributes(db.DB, id)
+}
+
+// categoryAttributes reads the attributes of a category and its ancestors.
+// Where a key is defined more than once, the definition nearest to the
+// category wins and takes the place of the inherited one.
+func categoryAttributes(q queryer, categoryId int64) ([]CategoryAttribute, error) {
+	rows, err := q.Query(`
+		WITH RECURSIVE ancestors(id, depth) AS (
+			SELECT ?, 0
+			UNION ALL
+			SELECT categories.parentId, ancestors.depth + 1
+			FROM categories JOIN ancestors ON categories.id = ancestors.id
+			WHERE categories.parentId IS NOT NULL AND ancestors.depth < ?
+		)
+		SELECT `+categoryAttributeColumns+`
+		FROM category_attributes JOIN ancestors ON category_attributes.categoryId = ancestors.id
+		ORDER BY ancestors.depth DESC, category_attributes.position, category_attributes.id`,
+		categoryId, maxCategoryDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attributes := []CategoryAttribute{}
+	byKey := map[string]int{}
+	for rows.Next() {
+		var a CategoryAttribute
+		if err := scanCategoryAttribute(rows, &a); err != nil {
+			return nil, err
+		}
+		if i, ok := byKey[a.Key]; ok {
+			attributes[i] = a
+			continue
+		}
+		byKey[a.Key] = len(attributes)
+		attributes = append(attributes, a)
+	}
+	return attributes, rows.Err()
+}
+
+func getCategoryAttribute(categoryId int64, key string) (*CategoryAttribute, error) {
+	var a CategoryAttribute
+	err := scanCategoryAttribute(db.DB.QueryRow(
+		"SELECT "+categoryAttributeColumns+" FROM category_attributes WHERE categoryId=? AND key=?", categoryId, key), &a)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrAttributeNotFound
+		}
+		return nil, err
+	}
+	return &a, nil
+}
+
+func findAttribute(schema []CategoryAttribute, key string) *CategoryAttribute {
+	for i := range schema {
+		if schema[i].Key == key {
+			return &schema[i]
+		}
+	}
+	return nil
+}
+
+// normalize trims and checks an attribute definition
+func (a *CategoryAttribute) normalize() error {
+	a.Key = strings.TrimSpace(a.Key)
+	a.Label = strings.TrimSpace(a.Label)
+	a.Unit = strings.TrimSpace(a.Unit)
+
+	if !validAttributeKey(a.Key) {
+		return fmt.Errorf("%w: key must be up to %d lower-case letters, digits or underscores, starting with a letter",
+			ErrInvalidAttribute, maxAttributeKeyLength)
+	}
+	if a.Label == "" || len([]rune(a.Label)) > maxAttributeLabelLength {
+		return fmt.Errorf("%w: label must be 1 to %d characters", ErrInvalidAttribute, maxAttributeLabelLength)
+	}
+
+	switch a.Type {
+	case AttributeEnum, AttributeNumber, AttributeBoolean, AttributeText:
+	default:
+		return fmt.Errorf("%w: type must be enum, number, boolean or text", ErrInvalidAttribute)
+	}
+	if a.Type != AttributeNumber && (a.Unit != "" || a.Min != nil || a.Max != nil) {
+		return fmt.Errorf("%w: unit, min and max only apply to numbers", ErrInvalidAttribute)
+	}
+	if a.Min != nil && a.Max != nil && *a.Min > *a.Max {
+		return fmt.Errorf("%w: min is greater than max", ErrInvalidAttribute)
+	}
+	if a.Type != AttributeEnum {
+		if len(a.Options) > 0 {
+			return fmt.Errorf("%w: options only apply to enums", ErrInvalidAttribute)
+		}
+		a.Options = []string{}
+		return nil
+	}
+
+	if len(a.Options) == 0 || len(a.Options) > maxAttributeOptions {
+		return fmt.Errorf("%w: an enum needs 1 to %d options", ErrInvalidAttribute, maxAttributeOptions)
+	}
+	seen := make(map[string]bool, len(a.Options))
+	for i, option := range a.Options {
+		option = strings.TrimSpace(option)
+		if option == "" || len([]rune(option)) > maxAttributeLabelLength {
+			return fmt.Errorf("%w: options must be 1 to %d characters", ErrInvalidAttribute, maxAttributeLabelLength)
+		}
+		if seen[option] {
+			return fmt.Errorf("%w: option %q is listed twice", ErrInvalidAttribute, option)
+		}
+		seen[option] = true
+		a.Options[i] = option
+	}
+	return nil
+}
+
+func validAttributeKey(key string) bool {
+	if key == "" || len(key) > maxAttributeKeyLength || key[0] < 'a' || key[0] > 'z' {
+		return false
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
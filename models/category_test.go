@@ -0,0 +1,113 @@
+package models
+
+import (
+	"errors"
+	"maps"
+	"testing"
+)
+
+func TestCategoryUpdateKeepsParent(t *testing.T) {
+	parent := newTestCategory(t, "Vehicles", nil)
+	child := newTestCategory(t, "Cars", &parent.Id)
+
+	rename := &Category{Id: child.Id, Name: "Motor Cars"}
+	if err := rename.Update(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := getCategory(child.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ParentId == nil || *got.ParentId != parent.Id {
+		t.Fatalf("after rename: parentId = %v, want %d", got.ParentId, parent.Id)
+	}
+	if got.Name != "Motor Cars" || got.Slug != child.Slug {
+		t.Errorf("after rename: name, slug = %q, %q, want %q, %q", got.Name, got.Slug, "Motor Cars", child.Slug)
+	}
+
+	topLevel := &Category{Id: child.Id, Name: "Motor Cars", ParentSet: true}
+	if err := topLevel.Update(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = getCategory(child.Id); err != nil {
+		t.Fatal(err)
+	}
+	if got.ParentId != nil {
+		t.Errorf("after parentId null: parentId = %d, want none", *got.ParentId)
+	}
+}
+
+func TestMergeCategoryDropsRejectedAttributes(t *testing.T) {
+	four := 4.0
+	source := newTestCategory(t, "Old cars", nil)
+	newTestAttribute(t, source.Id, CategoryAttribute{Key: "seats", Type: AttributeNumber})
+	newTestAttribute(t, source.Id, CategoryAttribute{Key: "fuel", Type: AttributeEnum, Options: []string{"diesel", "petrol"}})
+	newTestAttribute(t, source.Id, CategoryAttribute{Key: "colour", Type: AttributeText})
+	child := newTestCategory(t, "Old vans", &source.Id)
+	target := newTestCategory(t, "New cars", nil)
+	newTestAttribute(t, target.Id, CategoryAttribute{Key: "seats", Type: AttributeNumber, Max: &four})
+	newTestAttribute(t, target.Id, CategoryAttribute{Key: "fuel", Type: AttributeEnum, Options: []string{"diesel", "electric"}})
+
+	ownerId := newTestUser(t)
+	rejected := newTestPostWithAttributes(t, ownerId, source.Id, map[string]any{"seats": 5.0, "fuel": "petrol", "colour": "red"})
+	accepted := newTestPostWithAttributes(t, ownerId, source.Id, map[string]any{"seats": 3.0, "fuel": "diesel"})
+	inChild := newTestPostWithAttributes(t, ownerId, child.Id, map[string]any{"seats": 2.0, "colour": "blue"})
+	inTarget := newTestPostWithAttributes(t, ownerId, target.Id, map[string]any{"seats": 4.0, "fuel": "electric"})
+
+	move, err := MergeCategory(source.Id, target.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if move.MovedPosts != 2 || move.MovedSubcategories != 1 || move.DroppedAttributes != 4 {
+		t.Errorf("move = %+v, want 2 posts, 1 subcategory, 4 dropped attributes", *move)
+	}
+	for _, c := range []struct {
+		post *Post
+		want map[string]any
+	}{
+		{rejected, map[string]any{}},
+		{accepted, map[string]any{"seats": 3.0, "fuel": "diesel"}},
+		{inChild, map[string]any{"seats": 2.0}},
+		{inTarget, map[string]any{"seats": 4.0, "fuel": "electric"}},
+	} {
+		if got := postAttributes(t, c.post.Id); !maps.Equal(got, c.want) {
+			t.Errorf("post %d: attributes = %v, want %v", c.post.Id, got, c.want)
+		}
+	}
+}
+
+func TestReassignCategoryPostsDropsRejectedAttributes(t *testing.T) {
+	source := newTestCategory(t, "Bikes", nil)
+	newTestAttribute(t, source.Id, CategoryAttribute{Key: "gears", Type: AttributeNumber})
+	newTestAttribute(t, source.Id, CategoryAttribute{Key: "electric", Type: AttributeBoolean})
+	target := newTestCategory(t, "E-bikes", nil)
+	newTestAttribute(t, target.Id, CategoryAttribute{Key: "electric", Type: AttributeBoolean})
+
+	post := newTestPostWithAttributes(t, newTestUser(t), source.Id, map[string]any{"gears": 21.0, "electric": true})
+	move, err := ReassignCategoryPosts(source.Id, target.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if move.MovedPosts != 1 || move.DroppedAttributes != 1 {
+		t.Errorf("move = %+v, want 1 post, 1 dropped attribute", *move)
+	}
+	if got, want := postAttributes(t, post.Id), map[string]any{"electric": true}; !maps.Equal(got, want) {
+		t.Errorf("attributes = %v, want %v", got, want)
+	}
+}
+
+func TestCategorySlugAvoidsRoutes(t *testing.T) {
+	tree := newTestCategory(t, "Tree", nil)
+	if tree.Slug != "tree-2" {
+		t.Errorf("slug of a category named Tree = %q, want tree-2", tree.Slug)
+	}
+
+	explicit := &Category{Name: "Trees", Slug: "tree"}
+	if err := explicit.Save(); !errors.Is(err, ErrInvalidCategory) {
+		t.Errorf("Save with slug tree: err = %v, want ErrInvalidCategory", err)
+	}
+	rename := &Category{Id: tree.Id, Name: "Tree", Slug: "tree"}
+	if err := rename.Update(); !errors.Is(err, ErrInvalidCategory) {
+		t.Errorf("Update to slug tree: err = %v, want ErrInvalidCategory", err)
+	}
+}
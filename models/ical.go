@@ -0,0 +1,385 @@
+package models
+
+import (
+	"bytes"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"rentx/db"
+	"rentx/utils"
+	"syscall"
+	"time"
+)
+
+// Blackout sources
+const (
+	BlackoutManual     = "manual"
+	BlackoutICalURL    = "ical-url"    // synced from the post's registered external feed
+	BlackoutICalUpload = "ical-upload" // imported from an uploaded .ics file
+)
+
+// MaxICalSize caps fetched or uploaded .ics documents
+const MaxICalSize = 2 << 20
+
+// maxICalRedirects caps the redirects followed when fetching a feed
+const maxICalRedirects = 5
+
+// ICalHTTPClient fetches external calendars; replaceable for tests. Feed URLs
+// come from users, so it only connects to public addresses: the check runs on
+// the resolved address of every connection, redirects included.
+var ICalHTTPClient = &http.Client{
+	Timeout: 15 * time.Second,
+	Transport: &http.Transport{
+		Proxy: nil, // a proxy would make the dialed address the proxy's
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: refuseInternalAddress,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxICalRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxICalRedirects)
+		}
+		return nil
+	},
+}
+
+// errInternalAddress is returned when a feed URL leads to a loopback,
+// private, link-local or otherwise non-public address
+var errInternalAddress = errors.New("feed address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which also
+// holds some cloud metadata endpoints
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// refuseInternalAddress is a net.Dialer Control hook; it runs after DNS
+// resolution, so host names pointing at internal addresses are caught too
+func refuseInternalAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !publicAddress(ip) {
+		return fmt.Errorf("%w: %s", errInternalAddress, host)
+	}
+	return nil
+}
+
+// publicAddress reports whether ip is a globally routable unicast address.
+// Cloud metadata services (169.254.169.254, fd00:ec2::254) are link-local or
+// private and fail the check.
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsGlobalUnicast() && !ip.IsPrivate() && !ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() && !sharedAddressSpace.Contains(ip)
+}
+
+// ErrInvalidICal is returned for unreadable .ics documents and bad feed URLs
+var ErrInvalidICal = errors.New("invalid calendar")
+
+// CalendarFeed holds a post's iCalendar export token and external import settings
+type CalendarFeed struct {
+	PostId        int64  `json:"postId"`
+	FeedToken     string `json:"-"`
+	FeedPath      string `json:"feedPath"`
+	FeedUrl       string `json:"feedUrl"` // FeedPath on the public host, filled in by the handler
+	ImportUrl     string `json:"importUrl"`
+	LastSyncedAt  string `json:"lastSyncedAt"`
+	LastSyncError string `json:"lastSyncError"`
+}
+
+// GetCalendarFeed returns the calendar settings of a post, creating its
+// stable feed token on first use
+func GetCalendarFeed(postId int64) (*CalendarFeed, error) {
+	if _, err := GetPostStatus(postId); err != nil {
+		return nil, err
+	}
+
+	token, err := newFeedToken()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.DB.Exec(`
+		INSERT OR IGNORE INTO post_calendars (postId, feedToken) VALUES (?, ?)`, postId, token); err != nil {
+		return nil, err
+	}
+
+	var f CalendarFeed
+	var lastSyncedAt sql.NullString
+	err = db.DB.QueryRow(`
+		SELECT postId, feedToken, importUrl, lastSyncedAt, lastSyncError
+		FROM post_calendars WHERE postId=?`, postId).
+		Scan(&f.PostId, &f.FeedToken, &f.ImportUrl, &lastSyncedAt, &f.LastSyncError)
+	if err != nil {
+		return nil, err
+	}
+	f.LastSyncedAt = lastSyncedAt.String
+	f.FeedPath = "/ical/" + f.FeedToken + ".ics"
+	return &f, nil
+}
+
+// ExportICalByToken renders the bookings and blocked dates of the post
+// behind a feed token as an iCalendar document
+func ExportICalByToken(token string) ([]byte, error) {
+	var postId int64
+	var name string
+	err := db.DB.QueryRow(`
+		SELECT p.id, p.name FROM post_calendars c JOIN posts p ON p.id = c.postId
+		WHERE c.feedToken=?`, token).Scan(&postId, &name)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPostNotFound
+		}
+		return nil, err
+	}
+
+	var events []utils.ICalEvent
+	collect := func(uidPrefix, summary, query string, args ...interface{}) error {
+		rows, err := db.DB.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			var startDate, endDate string
+			if err := rows.Scan(&id, &startDate, &endDate); err != nil {
+				return err
+			}
+			start, end, err := utils.ParseDateRange(startDate, endDate)
+			if err != nil {
+				continue // legacy rows without dates
+			}
+			events = append(events, utils.ICalEvent{
+				UID:       fmt.Sprintf("%s-%d@rentx", uidPrefix, id),
+				Summary:   summary,
+				StartDate: start,
+				EndDate:   end,
+			})
+		}
+		return rows.Err()
+	}
+
+	today := utils.Today().Format(utils.DateLayout)
+	if err := collect("booking", "Booked", `
+		SELECT id, startDate, endDate FROM orders
+		WHERE postId=? AND endDate >= ? AND status NOT IN (?, ?)
+		ORDER BY startDate`, postId, today, OrderDeclined, OrderCancelled); err != nil {
+		return nil, err
+	}
+	if err := collect("blocked", "Unavailable", `
+		SELECT id, startDate, endDate FROM post_blackouts
+		WHERE postId=? AND endDate >= ?
+		ORDER BY startDate`, postId, today); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := utils.WriteICal(&buf, name, events); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SetICalImportURL registers (or, when empty, removes) the external feed of a
+// post. Removing it also drops the blocked dates that came from it.
+func SetICalImportURL(postId int64, importUrl string) error {
+	if importUrl != "" {
+		u, err := url.Parse(importUrl)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "webcal") || u.Host == "" {
+			return fmt.Errorf("%w: feed URL must be an http(s) or webcal URL", ErrInvalidICal)
+		}
+		if ip, err := netip.ParseAddr(u.Hostname()); (err == nil && !publicAddress(ip)) || u.Hostname() == "localhost" {
+			return fmt.Errorf("%w: feed URL must point to a public host", ErrInvalidICal)
+		}
+	}
+	if _, err := GetCalendarFeed(postId); err != nil {
+		return err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE post_calendars SET importUrl=?, lastSyncedAt=NULL, lastSyncError='' WHERE postId=?`,
+		importUrl, postId); err != nil {
+		return err
+	}
+	if importUrl == "" {
+		if _, err := tx.Exec("DELETE FROM post_blackouts WHERE postId=? AND source=?", postId, BlackoutICalURL); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SyncICalImport fetches the registered external feed of a post and replaces
+// the blocked dates previously imported from it. The outcome is recorded on
+// the post's calendar settings.
+func SyncICalImport(postId int64) error {
+	var importUrl string
+	err := db.DB.QueryRow("SELECT importUrl FROM post_calendars WHERE postId=?", postId).Scan(&importUrl)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if importUrl == "" {
+		return fmt.Errorf("%w: no feed URL registered", ErrInvalidICal)
+	}
+
+	syncErr := fetchAndImport(postId, importUrl)
+
+	errText := ""
+	if syncErr != nil {
+		errText = syncErr.Error()
+	}
+	if _, err := db.DB.Exec(`
+		UPDATE post_calendars SET lastSyncedAt=CURRENT_TIMESTAMP, lastSyncError=? WHERE postId=?`,
+		errText, postId); err != nil {
+		return err
+	}
+	return syncErr
+}
+
+// SyncAllICalImports re-syncs every post with a registered external feed,
+// continuing past individual failures
+func SyncAllICalImports() error {
+	rows, err := db.DB.Query("SELECT postId FROM post_calendars WHERE importUrl != ''")
+	if err != nil {
+		return err
+	}
+	var postIds []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		postIds = append(postIds, id)
+	}
+	rows.Close()
+
+	var failed int
+	for _, id := range postIds {
+		if err := SyncICalImport(id); err != nil {
+			failed++
+			fmt.Printf("⚠️  iCal sync failed for post %d: %v\n", id, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d calendar syncs failed", failed, len(postIds))
+	}
+	return nil
+}
+
+// ImportICalFile replaces the post's blocked dates from a previous upload
+// with the events of the given .ics document
+func ImportICalFile(postId int64, r io.Reader) (int, error) {
+	events, err := utils.ParseICal(io.LimitReader(r, MaxICalSize))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidICal, err)
+	}
+	return replaceImportedBlackouts(postId, BlackoutICalUpload, events)
+}
+
+func fetchAndImport(postId int64, importUrl string) error {
+	if u, err := url.Parse(importUrl); err == nil && u.Scheme == "webcal" {
+		u.Scheme = "https"
+		importUrl = u.String()
+	}
+
+	resp, err := ICalHTTPClient.Get(importUrl)
+	if err != nil {
+		return fmt.Errorf("fetching feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching feed: unexpected status %s", resp.Status)
+	}
+
+	events, err := utils.ParseICal(io.LimitReader(resp.Body, MaxICalSize))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidICal, err)
+	}
+	_, err = replaceImportedBlackouts(postId, BlackoutICalURL, events)
+	return err
+}
+
+// maxImportedBlackouts caps the blocked ranges one import may create, e.g.
+// from a daily recurring event
+const maxImportedBlackouts = 5000
+
+// replaceImportedBlackouts swaps all blocked dates of one import source for
+// the given events in a single transaction. Only the next MaxBlackoutDays
+// days are imported: recurring events are expanded over them, longer events
+// are clipped to them and past ones skipped. Imported ranges may overlap
+// bookings: they mirror commitments made elsewhere.
+func replaceImportedBlackouts(postId int64, source string, events []utils.ICalEvent) (int, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM post_blackouts WHERE postId=? AND source=?", postId, source); err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO post_blackouts (postId, startDate, endDate, reason, source, externalUid)
+		VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	today := utils.Today()
+	horizon := today.AddDate(0, 0, MaxBlackoutDays-1)
+	imported := 0
+	for _, ev := range events {
+		occurrences, err := ev.Occurrences(today, horizon)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidICal, err)
+		}
+		for _, o := range occurrences {
+			if imported == maxImportedBlackouts {
+				return 0, fmt.Errorf("%w: more than %d upcoming events", ErrInvalidICal, maxImportedBlackouts)
+			}
+			start, end := o.StartDate, o.EndDate
+			if start.Before(today) {
+				start = today
+			}
+			if end.After(horizon) {
+				end = horizon
+			}
+			_, err := stmt.Exec(postId, start.Format(utils.DateLayout), end.Format(utils.DateLayout),
+				o.Summary, source, o.UID)
+			if err != nil {
+				return 0, err
+			}
+			imported++
+		}
+	}
+
+	return imported, tx.Commit()
+}
+
+func newFeedToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
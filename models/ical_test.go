@@ -0,0 +1,173 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"rentx/db"
+	"rentx/utils"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetICalImportURLRejectsInternalHosts(t *testing.T) {
+	for _, feed := range []string{
+		"http://127.0.0.1/calendar.ics",
+		"http://localhost:8080/calendar.ics",
+		"webcal://[::1]/calendar.ics",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://10.0.0.5/calendar.ics",
+	} {
+		if err := SetICalImportURL(1, feed); !errors.Is(err, ErrInvalidICal) {
+			t.Errorf("SetICalImportURL(%q) = %v, want ErrInvalidICal", feed, err)
+		}
+	}
+}
+
+func TestICalHTTPClientRefusesLoopback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n"))
+	}))
+	defer srv.Close()
+
+	resp, err := ICalHTTPClient.Get(srv.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("fetching a loopback feed succeeded")
+	}
+	if !errors.Is(err, errInternalAddress) {
+		t.Fatalf("err = %v, want errInternalAddress", err)
+	}
+}
+
+func TestPublicAddress(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":    true,
+		"2606:4700::1111":  true,
+		"127.0.0.1":        false,
+		"::1":              false,
+		"0.0.0.0":          false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"fd00:ec2::254":    false,
+		"fe80::1":          false,
+		"100.100.100.200":  false,
+		"::ffff:127.0.0.1": false,
+		"224.0.0.1":        false,
+	} {
+		if got := publicAddress(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("publicAddress(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+// serveICalFeeds points ICalHTTPClient at a local stand-in for the external
+// calendar hosts for the rest of the test
+func serveICalFeeds(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	srv := httptest.NewTLSServer(handler)
+	t.Cleanup(srv.Close)
+
+	transport := srv.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.ServerName = "example.com" // in the stand-in's certificate
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, srv.Listener.Addr().String())
+	}
+	client := ICalHTTPClient
+	ICalHTTPClient = &http.Client{Transport: transport}
+	t.Cleanup(func() { ICalHTTPClient = client })
+}
+
+func icalDay(d time.Time) string {
+	return d.Format("20060102")
+}
+
+func TestSyncICalImport(t *testing.T) {
+	today := utils.Today()
+	horizon := today.AddDate(0, 0, MaxBlackoutDays-1)
+	feed := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT", "UID:trip", "SUMMARY:Trip",
+		"DTSTART;VALUE=DATE:" + icalDay(today.AddDate(0, 0, 10)), "DTEND;VALUE=DATE:" + icalDay(today.AddDate(0, 0, 13)),
+		"END:VEVENT",
+		"BEGIN:VEVENT", "UID:forever", "DTSTART;VALUE=DATE:00010101", "DTEND;VALUE=DATE:99991231", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:weekly", "DTSTART;VALUE=DATE:" + icalDay(today.AddDate(0, 0, -7)), "RRULE:FREQ=WEEKLY", "END:VEVENT",
+		"BEGIN:VEVENT", "UID:past", "DTSTART;VALUE=DATE:" + icalDay(today.AddDate(0, 0, -3)), "END:VEVENT",
+		"BEGIN:VEVENT", "UID:cancelled", "STATUS:CANCELLED", "DTSTART;VALUE=DATE:" + icalDay(today), "END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	status := http.StatusOK
+	serveICalFeeds(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "calendar.example.com" || r.URL.Path != "/feed.ics" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, feed)
+	})
+
+	post := newTestPost(t, newTestUser(t))
+	if err := SetICalImportURL(post.Id, "webcal://calendar.example.com/feed.ics"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SyncICalImport(post.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	blackouts, err := ListBlackouts(post.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byUid := map[string][]Blackout{}
+	for _, b := range blackouts {
+		if b.Source != BlackoutICalURL {
+			t.Errorf("blackout %+v has source %s", b, b.Source)
+		}
+		var uid string
+		db.DB.QueryRow("SELECT externalUid FROM post_blackouts WHERE id=?", b.Id).Scan(&uid)
+		byUid[uid] = append(byUid[uid], b)
+	}
+	day := func(d time.Time) string { return d.Format(utils.DateLayout) }
+	if trip := byUid["trip"]; len(trip) != 1 || trip[0].StartDate != day(today.AddDate(0, 0, 10)) ||
+		trip[0].EndDate != day(today.AddDate(0, 0, 12)) || trip[0].Reason != "Trip" {
+		t.Errorf("trip imported as %+v", trip)
+	}
+	if forever := byUid["forever"]; len(forever) != 1 || forever[0].StartDate != day(today) || forever[0].EndDate != day(horizon) {
+		t.Errorf("endless event imported as %+v, want %s..%s", forever, day(today), day(horizon))
+	}
+	if weekly := byUid["weekly"]; len(weekly) != MaxBlackoutDays/7+1 || weekly[0].StartDate != day(today) {
+		t.Errorf("weekly event imported as %d ranges from %+v, want %d from today", len(weekly), weekly[0], MaxBlackoutDays/7+1)
+	}
+	if len(byUid["past"]) != 0 || len(byUid["cancelled"]) != 0 {
+		t.Errorf("imported past or cancelled events: %+v", byUid)
+	}
+	if cal, err := GetCalendarFeed(post.Id); err != nil || cal.LastSyncError != "" || cal.LastSyncedAt == "" {
+		t.Errorf("after sync: %+v, %v", cal, err)
+	}
+
+	// a failing feed keeps the dates imported before and records the error
+	status = http.StatusBadGateway
+	if err := SyncICalImport(post.Id); err == nil {
+		t.Fatal("sync of a failing feed succeeded")
+	}
+	if cal, _ := GetCalendarFeed(post.Id); !strings.Contains(cal.LastSyncError, "502") {
+		t.Errorf("lastSyncError = %q", cal.LastSyncError)
+	}
+	if after, _ := ListBlackouts(post.Id); len(after) != len(blackouts) {
+		t.Errorf("failed sync left %d blocked ranges, want %d", len(after), len(blackouts))
+	}
+
+	// recurrence rules that cannot be expanded are an error, not fewer blocked days
+	status = http.StatusOK
+	feed = "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nDTSTART:20270101\r\nRRULE:FREQ=MONTHLY;BYDAY=-1FR\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	if err := SyncICalImport(post.Id); !errors.Is(err, ErrInvalidICal) {
+		t.Errorf("sync with an unsupported RRULE = %v, want ErrInvalidICal", err)
+	}
+}
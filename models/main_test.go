@@ -0,0 +1,97 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"rentx/db"
+	"testing"
+)
+
+// TestMain runs the package tests against a fresh database in a temporary
+// directory, since db.InitDB opens api.db in the working directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "rentx-models")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err := os.Chdir(dir); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Setenv("SUPERADMIN_NAME", "Admin")
+	os.Setenv("SUPERADMIN_EMAIL", "admin@example.com")
+	os.Setenv("SUPERADMIN_PHONE", "0000000000")
+	os.Setenv("SUPERADMIN_PASSWORD", "secret")
+	db.InitDB()
+
+	code := m.Run()
+	db.CloseDB()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fixtures numbers test users and categories to keep emails, phones and
+// slugs unique
+var fixtures int
+
+// newTestUser inserts a user with the "user" role
+func newTestUser(t *testing.T) int64 {
+	t.Helper()
+	fixtures++
+	res, err := db.DB.Exec("INSERT INTO users (name, email, phone, password, image, role) VALUES (?, ?, ?, 'x', '', 'user')",
+		t.Name(), fmt.Sprintf("user%d@example.com", fixtures), fmt.Sprintf("%010d", fixtures))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+// newTestCategory saves a category, under parentId when it is not nil
+func newTestCategory(t *testing.T, name string, parentId *int64) *Category {
+	t.Helper()
+	c := &Category{Name: name, ParentId: parentId}
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// newTestPost saves an approved post with a daily price and the given images
+func newTestPost(t *testing.T, ownerId int64, imageUrls ...string) *Post {
+	t.Helper()
+	fixtures++
+	category := newTestCategory(t, fmt.Sprintf("Category %d", fixtures), nil)
+	p := &Post{
+		UserId:      ownerId,
+		CategoryId:  category.Id,
+		Name:        "Bike",
+		Address:     "Main Street 1",
+		Description: "A bike",
+		DailyPrice:  10,
+		ImageUrls:   imageUrls,
+	}
+	if err := p.Save("admin"); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// newTestUpload records an uploaded image of userId and returns its URL
+func newTestUpload(t *testing.T, userId int64) string {
+	t.Helper()
+	fixtures++
+	url := fmt.Sprintf("/storage/posts/test%d.png", fixtures)
+	res, err := db.DB.Exec(`
+		INSERT INTO uploads (url, thumbUrl, mediumUrl, largeUrl, mime, width, height)
+		VALUES (?, ?, ?, ?, 'image/png', 10, 10)`, url, url, url, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadId, _ := res.LastInsertId()
+	if _, err := db.DB.Exec("INSERT INTO upload_owners (uploadId, userId) VALUES (?, ?)", uploadId, userId); err != nil {
+		t.Fatal(err)
+	}
+	return url
+}
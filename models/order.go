@@ -3,61 +3,203 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"rentx/db"
+	"rentx/utils"
 )
 
-// Order represents a single order
+// Order represents a single booking of a post for an inclusive date range
 type Order struct {
-	Id       int64  `json:"id"`
-	UserId   int64  `json:"userId" binding:"required"`
-	PostId   int64  `json:"postId" binding:"required"`
-	DateTime string `json:"dateTime"`
+	Id        int64           `json:"id"`
+	UserId    int64           `json:"userId"` // renter, taken from the auth token
+	PostId    int64           `json:"postId" binding:"required"`
+	StartDate string          `json:"startDate" binding:"required"` // YYYY-MM-DD
+	EndDate   string          `json:"endDate" binding:"required"`   // YYYY-MM-DD, inclusive
+	Status    string          `json:"status"`
+	Total     float64         `json:"total"`
+	LineItems []PriceLineItem `json:"lineItems,omitempty"`
+	DateTime  string          `json:"dateTime"`
 }
 
-// Create inserts a new order into the database
+// Booking errors
+var (
+	ErrInvalidDates    = errors.New("invalid booking dates")
+	ErrPostNotBookable = errors.New("post not found or not available for booking")
+	ErrBookingConflict = errors.New("post is already booked for some of the requested dates")
+	ErrOwnPost         = errors.New("you cannot book your own post")
+)
+
+// Create validates the date range, prices it from the post's rates and
+// inserts the order with its line items, rejecting any overlap with existing
+// bookings of the same post
 func (o *Order) Create() error {
-	res, err := db.DB.Exec(
-		"INSERT INTO orders (userId, postId) VALUES (?, ?)",
-		o.UserId, o.PostId,
+	startDate, err := utils.ParseDate(o.StartDate)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDates, err)
+	}
+	if startDate.Before(utils.Today()) {
+		return fmt.Errorf("%w: start date must not be in the past", ErrInvalidDates)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the quote also checks the post exists and is approved
+	quote, err := quotePost(tx, o.PostId, o.StartDate, o.EndDate)
+	if err != nil {
+		return err
+	}
+	// normalised to the canonical layout so string comparison in SQL is correct
+	o.StartDate = quote.StartDate
+	o.EndDate = quote.EndDate
+	o.Total = quote.Total
+	o.LineItems = quote.LineItems
+
+	var ownerId int64
+	if err := tx.QueryRow("SELECT userId FROM posts WHERE id=?", o.PostId).Scan(&ownerId); err != nil {
+		return err
+	}
+	if ownerId == o.UserId {
+		return ErrOwnPost
+	}
+
+	booked, err := hasBookingOverlap(tx, o.PostId, o.StartDate, o.EndDate)
+	if err != nil {
+		return err
+	}
+	if booked {
+		return ErrBookingConflict
+	}
+
+	blocked, err := hasBlackoutOverlap(tx, o.PostId, o.StartDate, o.EndDate)
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return ErrDatesBlocked
+	}
+
+	o.Status = OrderRequested
+	res, err := tx.Exec(
+		"INSERT INTO orders (userId, postId, startDate, endDate, status, totalPrice) VALUES (?, ?, ?, ?, ?, ?)",
+		o.UserId, o.PostId, o.StartDate, o.EndDate, o.Status, o.Total,
 	)
 	if err != nil {
 		return err
 	}
 	o.Id, _ = res.LastInsertId()
-	return nil
+
+	if err := recordOrderStatus(tx, o.Id, "", o.Status, o.UserId); err != nil {
+		return err
+	}
+
+	for _, item := range o.LineItems {
+		_, err := tx.Exec(`
+			INSERT INTO order_line_items (orderId, unit, quantity, unitPrice, amount)
+			VALUES (?, ?, ?, ?, ?)`,
+			o.Id, item.Unit, item.Quantity, item.UnitPrice, item.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
 // Delete removes an order from the database
 func (o *Order) Delete() error {
-	_, err := db.DB.Exec("DELETE FROM orders WHERE id=?", o.Id)
-	return err
+	res, err := db.DB.Exec("DELETE FROM orders WHERE id=?", o.Id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrOrderNotFound
+	}
+	return nil
 }
 
 // GetOrder fetches a single order by ID
 func GetOrder(id int64) (*Order, error) {
-	row := db.DB.QueryRow("SELECT id, userId, postId, dateTime FROM orders WHERE id=?", id)
+	row := db.DB.QueryRow("SELECT id, userId, postId, startDate, endDate, status, totalPrice, dateTime FROM orders WHERE id=?", id)
 	var o Order
-	if err := row.Scan(&o.Id, &o.UserId, &o.PostId, &o.DateTime); err != nil {
+	if err := row.Scan(&o.Id, &o.UserId, &o.PostId, &o.StartDate, &o.EndDate, &o.Status, &o.Total, &o.DateTime); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("order not found")
+			return nil, ErrOrderNotFound
 		}
 		return nil, err
 	}
+
+	rows, err := db.DB.Query(`
+		SELECT unit, quantity, unitPrice, amount FROM order_line_items
+		WHERE orderId=? ORDER BY id ASC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	o.LineItems = []PriceLineItem{}
+	for rows.Next() {
+		var item PriceLineItem
+		if err := rows.Scan(&item.Unit, &item.Quantity, &item.UnitPrice, &item.Amount); err != nil {
+			return nil, err
+		}
+		o.LineItems = append(o.LineItems, item)
+	}
+
 	return &o, nil
 }
 
-// ListOrders fetches all orders
-func ListOrders() ([]Order, error) {
-	rows, err := db.DB.Query("SELECT id, userId, postId, dateTime FROM orders")
+// GetOrderParties returns the renter and the post owner of an order
+func GetOrderParties(orderId int64) (renterId int64, ownerId int64, err error) {
+	err = db.DB.QueryRow(`
+		SELECT o.userId, p.userId FROM orders o JOIN posts p ON p.id = o.postId
+		WHERE o.id=?`, orderId).Scan(&renterId, &ownerId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, ErrOrderNotFound
+	}
+	return renterId, ownerId, err
+}
+
+// CanAccessOrder checks that the user is the renter, the post owner or an admin
+func CanAccessOrder(orderId, userId int64, role string) error {
+	renterId, ownerId, err := GetOrderParties(orderId)
+	if err != nil {
+		return err
+	}
+	if userId != renterId && userId != ownerId && role != "admin" && role != "superadmin" {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// ListOrders fetches the orders visible to a user: admins see every order,
+// everyone else sees orders they placed and orders on posts they own
+func ListOrders(userId int64, role string) ([]Order, error) {
+	query := `
+		SELECT o.id, o.userId, o.postId, o.startDate, o.endDate, o.status, o.totalPrice, o.dateTime
+		FROM orders o JOIN posts p ON p.id = o.postId`
+	var args []interface{}
+
+	if role != "admin" && role != "superadmin" {
+		query += " WHERE o.userId=? OR p.userId=?"
+		args = append(args, userId, userId)
+	}
+	query += " ORDER BY o.id DESC"
+
+	rows, err := db.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var orders []Order
+	orders := []Order{}
 	for rows.Next() {
 		var o Order
-		if err := rows.Scan(&o.Id, &o.UserId, &o.PostId, &o.DateTime); err != nil {
+		if err := rows.Scan(&o.Id, &o.UserId, &o.PostId, &o.StartDate, &o.EndDate, &o.Status, &o.Total, &o.DateTime); err != nil {
 			return nil, err
 		}
 		orders = append(orders, o)
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"rentx/db"
+)
+
+// Order statuses
+const (
+	OrderRequested = "requested"
+	OrderAccepted  = "accepted"
+	OrderDeclined  = "declined"
+	OrderActive    = "active"
+	OrderReturned  = "returned"
+	OrderCompleted = "completed"
+	OrderCancelled = "cancelled"
+)
+
+// Parties allowed to perform a transition
+const (
+	actorOwner  = "owner"
+	actorRenter = "renter"
+)
+
+// orderTransitions maps current status → next status → party allowed to make the move.
+// Admins may perform any listed transition on behalf of either party.
+var orderTransitions = map[string]map[string]string{
+	OrderRequested: {
+		OrderAccepted:  actorOwner,
+		OrderDeclined:  actorOwner,
+		OrderCancelled: actorRenter,
+	},
+	OrderAccepted: {
+		OrderActive:    actorOwner, // item handed over
+		OrderCancelled: actorRenter,
+	},
+	OrderActive: {
+		OrderReturned: actorOwner,
+	},
+	OrderReturned: {
+		OrderCompleted: actorOwner,
+	},
+}
+
+// ErrInvalidTransition is returned when an order cannot move to the requested status
+var ErrInvalidTransition = errors.New("invalid order status transition")
+
+// ErrOrderNotFound is returned when an order does not exist
+var ErrOrderNotFound = errors.New("order not found")
+
+// OrderStatusChange is one entry of an order's status history
+type OrderStatusChange struct {
+	Id         int64  `json:"id"`
+	OrderId    int64  `json:"orderId"`
+	FromStatus string `json:"fromStatus"`
+	ToStatus   string `json:"toStatus"`
+	ActorId    int64  `json:"actorId"`
+	DateTime   string `json:"dateTime"`
+}
+
+// IsValidOrderStatus reports whether status is a known order status
+func IsValidOrderStatus(status string) bool {
+	switch status {
+	case OrderRequested, OrderAccepted, OrderDeclined, OrderActive, OrderReturned, OrderCompleted, OrderCancelled:
+		return true
+	}
+	return false
+}
+
+// TransitionOrder moves an order to a new status if the transition is allowed
+// for the acting user, and records it in the status history
+func TransitionOrder(orderId int64, toStatus string, actorId int64, role string) (*Order, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var renterId, ownerId int64
+	var fromStatus string
+	err = tx.QueryRow(`
+		SELECT o.userId, p.userId, o.status
+		FROM orders o JOIN posts p ON p.id = o.postId
+		WHERE o.id=?`, orderId).Scan(&renterId, &ownerId, &fromStatus)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+
+	isAdmin := role == "admin" || role == "superadmin"
+	if actorId != renterId && actorId != ownerId && !isAdmin {
+		return nil, ErrUnauthorized
+	}
+
+	party, ok := orderTransitions[fromStatus][toStatus]
+	if !ok {
+		return nil, fmt.Errorf("%w: cannot move order from %s to %s", ErrInvalidTransition, fromStatus, toStatus)
+	}
+	if !isAdmin {
+		if (party == actorOwner && actorId != ownerId) || (party == actorRenter && actorId != renterId) {
+			return nil, fmt.Errorf("%w: only the %s can move an order to %s", ErrUnauthorized, party, toStatus)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE orders SET status=? WHERE id=?", toStatus, orderId); err != nil {
+		return nil, err
+	}
+	if err := recordOrderStatus(tx, orderId, fromStatus, toStatus, actorId); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return GetOrder(orderId)
+}
+
+// ListOrderHistory returns the status changes of an order, oldest first
+func ListOrderHistory(orderId int64) ([]OrderStatusChange, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, orderId, fromStatus, toStatus, actorId, dateTime
+		FROM order_status_history WHERE orderId=? ORDER BY id ASC`, orderId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []OrderStatusChange{}
+	for rows.Next() {
+		var h OrderStatusChange
+		if err := rows.Scan(&h.Id, &h.OrderId, &h.FromStatus, &h.ToStatus, &h.ActorId, &h.DateTime); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, nil
+}
+
+func recordOrderStatus(tx *sql.Tx, orderId int64, fromStatus, toStatus string, actorId int64) error {
+	_, err := tx.Exec(`
+		INSERT INTO order_status_history (orderId, fromStatus, toStatus, actorId)
+		VALUES (?, ?, ?, ?)`, orderId, fromStatus, toStatus, actorId)
+	return err
+}
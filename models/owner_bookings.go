@@ -0,0 +1,137 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"rentx/db"
+	"rentx/utils"
+)
+
+// Pseudo statuses accepted by the owner bookings filter in addition to the order statuses
+const (
+	BookingsUpcoming = "upcoming" // accepted, starting today or later
+	// BookingsOverdue needs the owner's attention: accepted but past its start
+	// date without being picked up, or active past its end date
+	BookingsOverdue = "overdue"
+)
+
+// overdueBooking matches overdue orders (alias o), given OrderAccepted,
+// today, OrderActive and today
+const overdueBooking = "(o.status = ? AND o.startDate < ? OR o.status = ? AND o.endDate < ?)"
+
+// ErrInvalidFilter is returned for malformed list/search query parameters
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// IncomingBooking is an order on one of the caller's posts, with display names
+type IncomingBooking struct {
+	Order
+	RenterName string `json:"renterName"`
+	PostName   string `json:"postName"`
+}
+
+// BookingFilter narrows the owner's incoming bookings. From/To select
+// bookings whose dates overlap the range; either bound may be empty.
+type BookingFilter struct {
+	Status string
+	From   string
+	To     string
+}
+
+// BookingSummary counts the owner's bookings by what needs attention
+type BookingSummary struct {
+	Requested int `json:"requested"`
+	Upcoming  int `json:"upcoming"`
+	Active    int `json:"active"`
+	Overdue   int `json:"overdue"`
+	Completed int `json:"completed"`
+}
+
+// ListIncomingBookings returns orders on posts owned by ownerId, newest start first
+func ListIncomingBookings(ownerId int64, filter BookingFilter) ([]IncomingBooking, error) {
+	query := `
+		SELECT o.id, o.userId, o.postId, o.startDate, o.endDate, o.status, o.totalPrice, o.dateTime,
+			u.name, p.name
+		FROM orders o
+		JOIN posts p ON p.id = o.postId
+		JOIN users u ON u.id = o.userId
+		WHERE p.userId=?`
+	args := []interface{}{ownerId}
+	today := utils.Today().Format(utils.DateLayout)
+
+	switch filter.Status {
+	case "":
+	case BookingsUpcoming:
+		query += " AND o.status=? AND o.startDate >= ?"
+		args = append(args, OrderAccepted, today)
+	case BookingsOverdue:
+		query += " AND " + overdueBooking
+		args = append(args, OrderAccepted, today, OrderActive, today)
+	default:
+		if !IsValidOrderStatus(filter.Status) {
+			return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidFilter, filter.Status)
+		}
+		query += " AND o.status=?"
+		args = append(args, filter.Status)
+	}
+
+	if filter.From != "" {
+		from, err := utils.ParseDate(filter.From)
+		if err != nil {
+			return nil, fmt.Errorf("%w: from: %v", ErrInvalidFilter, err)
+		}
+		query += " AND o.endDate >= ?"
+		args = append(args, from.Format(utils.DateLayout))
+	}
+	if filter.To != "" {
+		to, err := utils.ParseDate(filter.To)
+		if err != nil {
+			return nil, fmt.Errorf("%w: to: %v", ErrInvalidFilter, err)
+		}
+		query += " AND o.startDate <= ?"
+		args = append(args, to.Format(utils.DateLayout))
+	}
+	query += " ORDER BY o.startDate DESC, o.id DESC"
+
+	rows, err := db.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bookings := []IncomingBooking{}
+	for rows.Next() {
+		var b IncomingBooking
+		if err := rows.Scan(&b.Id, &b.UserId, &b.PostId, &b.StartDate, &b.EndDate, &b.Status, &b.Total, &b.DateTime,
+			&b.RenterName, &b.PostName); err != nil {
+			return nil, err
+		}
+		bookings = append(bookings, b)
+	}
+	return bookings, nil
+}
+
+// GetBookingSummary counts the owner's bookings for the inbox badges
+func GetBookingSummary(ownerId int64) (*BookingSummary, error) {
+	today := utils.Today().Format(utils.DateLayout)
+	var s BookingSummary
+	err := db.DB.QueryRow(`
+		SELECT
+			COALESCE(SUM(o.status = ?), 0),
+			COALESCE(SUM(o.status = ? AND o.startDate >= ?), 0),
+			COALESCE(SUM(o.status = ? AND o.endDate >= ?), 0),
+			COALESCE(SUM(`+overdueBooking+`), 0),
+			COALESCE(SUM(o.status = ?), 0)
+		FROM orders o JOIN posts p ON p.id = o.postId
+		WHERE p.userId=?`,
+		OrderRequested,
+		OrderAccepted, today,
+		OrderActive, today,
+		OrderAccepted, today, OrderActive, today,
+		OrderCompleted,
+		ownerId,
+	).Scan(&s.Requested, &s.Upcoming, &s.Active, &s.Overdue, &s.Completed)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"rentx/db"
+	"rentx/utils"
+	"slices"
+	"testing"
+)
+
+func TestIncomingBookingBuckets(t *testing.T) {
+	ownerId, renterId := newTestUser(t), newTestUser(t)
+	post := newTestPost(t, ownerId)
+	day := func(n int) string { return utils.Today().AddDate(0, 0, n).Format(utils.DateLayout) }
+	order := func(status string, start, end int) int64 {
+		t.Helper()
+		res, err := db.DB.Exec("INSERT INTO orders (userId, postId, startDate, endDate, status) VALUES (?, ?, ?, ?, ?)",
+			renterId, post.Id, day(start), day(end), status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		return id
+	}
+
+	startsToday := order(OrderAccepted, 0, 2)
+	startsLater := order(OrderAccepted, 5, 7)
+	notPickedUp := order(OrderAccepted, -1, 2)
+	missed := order(OrderAccepted, -5, -3)
+	endsToday := order(OrderActive, -2, 0)
+	late := order(OrderActive, -4, -1)
+	order(OrderRequested, 3, 4)
+	order(OrderCompleted, -9, -7)
+
+	for status, want := range map[string][]int64{
+		BookingsUpcoming: {startsToday, startsLater},
+		BookingsOverdue:  {notPickedUp, missed, late},
+		OrderActive:      {endsToday, late},
+	} {
+		bookings, err := ListIncomingBookings(ownerId, BookingFilter{Status: status})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		for _, b := range bookings {
+			got = append(got, b.Id)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: orders %v, want %v", status, got, want)
+		}
+	}
+
+	summary, err := GetBookingSummary(ownerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BookingSummary{Requested: 1, Upcoming: 2, Active: 1, Overdue: 3, Completed: 1}
+	if *summary != want {
+		t.Errorf("summary = %+v, want %+v", *summary, want)
+	}
+}
@@ -1,116 +1,279 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"rentx/db"
+	"rentx/geo"
+	"rentx/utils"
+	"slices"
+	"strings"
 )
 
 type Post struct {
-	Id           int64    `json:"id"`
-	UserId       int64    `json:"userId"`
-	CategoryId   int64    `json:"categoryId" binding:"required"`
-	Name         string   `json:"name" binding:"required"`
-	Address      string   `json:"address" binding:"required"`
-	Description  string   `json:"description" binding:"required"`
-	DailyPrice   float64  `json:"dailyPrice"`
-	WeeklyPrice  float64  `json:"weeklyPrice"`
-	MonthlyPrice float64  `json:"monthlyPrice"`
-	ImageUrls    []string `json:"imageUrls"`
-	Status       string   `json:"status"`
-	DateTime     string   `json:"dateTime"`
+	Id           int64       `json:"id"`
+	UserId       int64       `json:"userId"`
+	CategoryId   int64       `json:"categoryId" binding:"required"`
+	Name         string      `json:"name" binding:"required"`
+	Address      string      `json:"address" binding:"required"`
+	Description  string      `json:"description" binding:"required"`
+	DailyPrice   float64     `json:"dailyPrice"`
+	WeeklyPrice  float64     `json:"weeklyPrice"`
+	MonthlyPrice float64     `json:"monthlyPrice"`
+	Latitude     *float64    `json:"latitude"`             // geocoded from the address when omitted
+	Longitude    *float64    `json:"longitude"`            // geocoded from the address when omitted
+	DistanceKm   *float64    `json:"distanceKm,omitempty"` // set by location searches only
+	ImageUrls    []string    `json:"imageUrls,omitempty"`  // input only: image URLs in display order
+	Images       []PostImage `json:"images"`
+	// Attributes holds values for the attributes of the category, e.g.
+	// {"seats": 5, "fuel": "diesel"}; see CategoryAttribute
+	Attributes map[string]any `json:"attributes"`
+	Status     string         `json:"status"`
+	// ModerationReason explains the latest rejection; empty otherwise
+	ModerationReason string `json:"moderationReason"`
+	// RatingAverage is the average star rating of the post's reviews (0 until
+	// rated) and RatingCount the number of rated reviews. The owner's rating
+	// over all their posts is not repeated on every post; it is read once per
+	// owner from GetOwnerRatingSummary.
+	RatingAverage float64 `json:"ratingAverage"`
+	RatingCount   int     `json:"ratingCount"`
+	DateTime      string  `json:"dateTime"`
 }
 
-// Save inserts a new post with images
+// PostImage is an image of a post with its resized variants. Images that
+// were not uploaded here (external URLs) use the original for every size.
+type PostImage struct {
+	Id        int64  `json:"id"`
+	Url       string `json:"url"`
+	ThumbUrl  string `json:"thumbUrl"`
+	MediumUrl string `json:"mediumUrl"`
+	LargeUrl  string `json:"largeUrl"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	AltText   string `json:"altText"`
+	Caption   string `json:"caption"`
+	// IsCover marks the image shown for the post in listings: the one chosen
+	// by the owner, otherwise the first
+	IsCover bool `json:"isCover"`
+}
+
+// PostGeocoder resolves post addresses to coordinates; replaceable at startup
+var PostGeocoder geo.Geocoder = geo.NewStaticGeocoder(nil)
+
+// ErrInvalidLocation is returned for out-of-range or half-specified coordinates
+var ErrInvalidLocation = errors.New("invalid location")
+
+// postColumns are the posts columns read by scanPost, in order
+const postColumns = `posts.id, posts.userId, posts.categoryId, posts.name, posts.address, posts.description,
+	posts.dailyPrice, posts.weeklyPrice, posts.monthlyPrice, posts.latitude, posts.longitude,
+	posts.status, posts.moderationReason, posts.ratingAverage, posts.ratingCount, posts.dateTime`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPost reads postColumns, followed by any extra selected columns, into p
+func scanPost(row rowScanner, p *Post, extra ...interface{}) error {
+	dest := []interface{}{&p.Id, &p.UserId, &p.CategoryId, &p.Name, &p.Address, &p.Description,
+		&p.DailyPrice, &p.WeeklyPrice, &p.MonthlyPrice, &p.Latitude, &p.Longitude, &p.Status, &p.ModerationReason,
+		&p.RatingAverage, &p.RatingCount, &p.DateTime}
+	return row.Scan(append(dest, extra...)...)
+}
+
+// resolveLocation validates explicit coordinates, or geocodes the address
+// when none were given. An address the geocoder cannot place leaves the
+// post without coordinates; it is then simply absent from location searches.
+func (p *Post) resolveLocation() error {
+	if (p.Latitude == nil) != (p.Longitude == nil) {
+		return fmt.Errorf("%w: latitude and longitude must be set together", ErrInvalidLocation)
+	}
+	if p.Latitude != nil {
+		if !(geo.Point{Lat: *p.Latitude, Lng: *p.Longitude}).Valid() {
+			return fmt.Errorf("%w: latitude must be within ±90 and longitude within ±180", ErrInvalidLocation)
+		}
+		return nil
+	}
+
+	point, err := PostGeocoder.Geocode(context.Background(), p.Address)
+	if err != nil {
+		if !errors.Is(err, geo.ErrNotFound) {
+			fmt.Printf("⚠️  Geocoding %q failed: %v\n", p.Address, err)
+		}
+		return nil
+	}
+	p.Latitude, p.Longitude = &point.Lat, &point.Lng
+	return nil
+}
+
+// Save inserts a new post (or a draft, when Status is "draft") with images and records its initial moderation status
 func (p *Post) Save(role string) error {
 	// Ensure new posts have 'pending' status by default for normal users. Else, auto approvede
-	if role == "admin" || role == "superadmin" {
-		p.Status = "approved"
-	} else {
-		p.Status = "pending"
+	switch {
+	case p.Status == PostDraft:
+		// drafts stay private until the owner submits them
+	case role == "admin" || role == "superadmin":
+		p.Status = PostApproved
+	default:
+		p.Status = PostPending
+	}
+	p.ModerationReason = ""
+	if err := p.resolveLocation(); err != nil {
+		return err
+	}
+	if err := p.resolveAttributes(nil); err != nil {
+		return err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
+
 	// Insert post
-	res, err := db.DB.Exec(`
+	res, err := tx.Exec(`
 		INSERT INTO posts 
-		(userId, categoryId, name, address, description, dailyPrice, weeklyPrice, monthlyPrice, status)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		p.UserId, p.CategoryId, p.Name, p.Address, p.Description, p.DailyPrice, p.WeeklyPrice, p.MonthlyPrice, p.Status)
+		(userId, categoryId, name, address, description, dailyPrice, weeklyPrice, monthlyPrice, latitude, longitude, status)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.UserId, p.CategoryId, p.Name, p.Address, p.Description, p.DailyPrice, p.WeeklyPrice, p.MonthlyPrice,
+		p.Latitude, p.Longitude, p.Status)
 	if err != nil {
 		return err
 	}
 	p.Id, _ = res.LastInsertId()
 
-	// Insert images if any
-	if len(p.ImageUrls) > 0 {
-		tx, err := db.DB.Begin()
-		if err != nil {
-			return err
-		}
-
-		stmt, err := tx.Prepare(`
-			INSERT INTO post_images (postId, imageUrl, position) VALUES (?, ?, ?)`)
-		if err != nil {
-			tx.Rollback()
-			return err
-		}
-		defer stmt.Close()
-
-		for i, url := range p.ImageUrls {
-			if url == "" {
-				continue
-			}
-			if _, err := stmt.Exec(p.Id, url, i); err != nil {
-				tx.Rollback()
-				return err
-			}
-		}
+	if err := checkImageOwnership(tx, 0, p.UserId, p.ImageUrls); err != nil {
+		return err
+	}
+	if err := insertPostImages(tx, p.Id, p.ImageUrls); err != nil {
+		return err
+	}
+	if err := replacePostAttributes(tx, p.Id, p.Attributes); err != nil {
+		return err
+	}
+	if err := recordPostModeration(tx, p.Id, "", p.Status, "", p.UserId); err != nil {
+		return err
+	}
 
-		if err := tx.Commit(); err != nil {
-			return err
-		}
+	if err := tx.Commit(); err != nil {
+		return err
 	}
 
-	return nil
+	// respond with the stored images and attributes; imageUrls is input only
+	p.ImageUrls = nil
+	return loadPostDetails(p)
 }
 
-// Update updates a post (owner or admin)
+// Update updates a post (owner or admin). Status is not editable here; it
+// changes through moderation, except that an owner's content edit of an
+// approved post sends it back to pending. Without explicit coordinates the
+// stored ones are kept unless the address changed, which geocodes it again.
+// Images are only changed when imageUrls is sent; images that stay keep their
+// id, alt text, caption and cover flag. Attributes likewise; see
+// resolveAttributes.
 func (p *Post) Update(userId int64, role string) error {
-	query := `
-		UPDATE posts SET categoryId=?, name=?, address=?, description=?, dailyPrice=?, weeklyPrice=?, monthlyPrice=?, status=?
-		WHERE id=?`
-	args := []interface{}{p.CategoryId, p.Name, p.Address, p.Description, p.DailyPrice, p.WeeklyPrice, p.MonthlyPrice, p.Status, p.Id}
+	isAdmin := role == "admin" || role == "superadmin"
+	errNotAllowed := errors.New("unauthorized or post not found")
 
-	if role != "admin" && role != "superadmin" {
-		query += " AND userId=?"
-		args = append(args, userId)
+	current, err := getPost(p.Id)
+	if err != nil {
+		if errors.Is(err, ErrPostNotFound) {
+			return errNotAllowed
+		}
+		return err
+	}
+	if current.UserId != userId && !isAdmin {
+		return errNotAllowed
 	}
 
-	res, err := db.DB.Exec(query, args...)
+	if p.Latitude == nil && p.Longitude == nil && p.Address == current.Address {
+		p.Latitude, p.Longitude = current.Latitude, current.Longitude
+	}
+	if err := p.resolveLocation(); err != nil {
+		return err
+	}
+	if err := p.resolveAttributes(current); err != nil {
+		return err
+	}
+
+	p.UserId = current.UserId
+	p.DateTime = current.DateTime
+	p.RatingAverage, p.RatingCount = current.RatingAverage, current.RatingCount
+	p.Status = current.Status
+	p.ModerationReason = current.ModerationReason
+	if current.Status == PostApproved && !isAdmin && contentChanged(current, p) {
+		p.Status = PostPending
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// the status guard turns a concurrent moderation decision into a retryable failure
+	res, err := tx.Exec(`
+		UPDATE posts SET categoryId=?, name=?, address=?, description=?, dailyPrice=?, weeklyPrice=?, monthlyPrice=?,
+			latitude=?, longitude=?, status=?
+		WHERE id=? AND status=?`,
+		p.CategoryId, p.Name, p.Address, p.Description, p.DailyPrice, p.WeeklyPrice, p.MonthlyPrice,
+		p.Latitude, p.Longitude, p.Status, p.Id, current.Status)
 	if err != nil {
 		return err
 	}
 	ra, _ := res.RowsAffected()
 	if ra == 0 {
-		return errors.New("unauthorized or post not found")
+		return fmt.Errorf("%w: post status changed during the update, try again", ErrInvalidPostTransition)
+	}
+
+	if p.ImageUrls != nil {
+		if err := checkImageOwnership(tx, p.Id, userId, p.ImageUrls); err != nil {
+			return err
+		}
+		if err := replacePostImages(tx, p.Id, p.ImageUrls); err != nil {
+			return err
+		}
+	}
+	if p.Attributes != nil {
+		if err := replacePostAttributes(tx, p.Id, p.Attributes); err != nil {
+			return err
+		}
 	}
 
-	_, err = db.DB.Exec("DELETE FROM post_images WHERE postId=?", p.Id)
+	if p.Status != current.Status {
+		if err := recordPostModeration(tx, p.Id, current.Status, p.Status, reasonContentEdited, userId); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// respond with the stored images and attributes; imageUrls is input only
+	p.ImageUrls = nil
+	return loadPostDetails(p)
+}
+
+// insertPostImages stores image URLs in display order, skipping blanks
+func insertPostImages(tx *sql.Tx, postId int64, urls []string) error {
+	stmt, err := tx.Prepare(`
+		INSERT INTO post_images (postId, imageUrl, position) VALUES (?, ?, ?)`)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
 
-	for i, url := range p.ImageUrls {
+	for i, url := range urls {
 		if url == "" {
 			continue
 		}
-		_, err := db.DB.Exec(`
-			INSERT INTO post_images (postId, imageUrl, position)
-			VALUES (?, ?, ?)`, p.Id, url, i)
-		if err != nil {
+		if _, err := stmt.Exec(postId, url, i); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
@@ -136,43 +299,46 @@ func (p *Post) Delete(userId int64, role string) error {
 	return nil
 }
 
-// GetPostByID fetches a single post with images
-func GetPostByID(id int64) (*Post, error) {
-	row := db.DB.QueryRow(`
-		SELECT id, userId, categoryId, name, address, description, dailyPrice, weeklyPrice, monthlyPrice, status, dateTime
-		FROM posts WHERE id=? AND status='approved'`, id)
-	var p Post
-	err := row.Scan(&p.Id, &p.UserId, &p.CategoryId, &p.Name, &p.Address, &p.Description, &p.DailyPrice, &p.WeeklyPrice, &p.MonthlyPrice, &p.Status, &p.DateTime)
+// GetPostByID fetches a single post with images. Approved posts are public;
+// other statuses are visible to the owner and admins only.
+func GetPostByID(id, userId int64, role string) (*Post, error) {
+	p, err := getPost(id)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("post not found")
-		}
 		return nil, err
 	}
+	if p.Status != PostApproved && p.UserId != userId && role != "admin" && role != "superadmin" {
+		return nil, ErrPostNotFound
+	}
+	return p, nil
+}
 
-	rows, err := db.DB.Query(`SELECT imageUrl FROM post_images WHERE postId=? ORDER BY position ASC`, id)
+// getPost loads a post with its images regardless of status
+func getPost(id int64) (*Post, error) {
+	var p Post
+	err := scanPost(db.DB.QueryRow(`SELECT `+postColumns+` FROM posts WHERE id=?`, id), &p)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPostNotFound
+		}
 		return nil, err
 	}
-	defer rows.Close()
-
-	p.ImageUrls = []string{}
-	for rows.Next() {
-		var url string
-		if err := rows.Scan(&url); err != nil {
-			return nil, err
-		}
-		p.ImageUrls = append(p.ImageUrls, url)
+	if err := loadPostDetails(&p); err != nil {
+		return nil, err
 	}
-
 	return &p, nil
 }
 
-// ListApprovedPosts fetches all approved posts with images
-func ListApprovedPosts() ([]Post, error) {
-	rows, err := db.DB.Query(`
-		SELECT id, userId, categoryId, name, address, description, dailyPrice, weeklyPrice, monthlyPrice, status, dateTime 
-		FROM posts WHERE status='approved'`)
+// ListOwnerPosts returns every post of an owner, newest first, optionally
+// limited to one status
+func ListOwnerPosts(ownerId int64, status string) ([]Post, error) {
+	query := `SELECT ` + postColumns + ` FROM posts WHERE userId=?`
+	args := []interface{}{ownerId}
+	if status != "" {
+		query += " AND status=?"
+		args = append(args, status)
+	}
+
+	rows, err := db.DB.Query(query+" ORDER BY id DESC", args...)
 	if err != nil {
 		return nil, err
 	}
@@ -181,35 +347,26 @@ func ListApprovedPosts() ([]Post, error) {
 	posts := []Post{}
 	for rows.Next() {
 		var p Post
-		if err := rows.Scan(&p.Id, &p.UserId, &p.CategoryId, &p.Name, &p.Address, &p.Description, &p.DailyPrice, &p.WeeklyPrice, &p.MonthlyPrice, &p.Status, &p.DateTime); err != nil {
-			return nil, err
-		}
-
-		imageRows, err := db.DB.Query(`SELECT imageUrl FROM post_images WHERE postId=? ORDER BY position ASC`, p.Id)
-		if err != nil {
+		if err := scanPost(rows, &p); err != nil {
 			return nil, err
 		}
-		defer imageRows.Close()
-
-		p.ImageUrls = []string{}
-		for imageRows.Next() {
-			var url string
-			if err := imageRows.Scan(&url); err != nil {
-				return nil, err
-			}
-			p.ImageUrls = append(p.ImageUrls, url)
-		}
-		defer imageRows.Close()
 		posts = append(posts, p)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
+	if err := loadPostDetails(postRefs(posts)...); err != nil {
+		return nil, err
+	}
 	return posts, nil
 }
 
 // ListPendingPosts returns all posts with status "pending"
 func ListPendingPosts() ([]Post, error) {
 	rows, err := db.DB.Query(`
-        SELECT id, userId, categoryId, name, address, description, dailyPrice, weeklyPrice, monthlyPrice, status, dateTime 
+        SELECT ` + postColumns + ` 
         FROM posts WHERE status='pending'`)
 	if err != nil {
 		return nil, err
@@ -219,90 +376,235 @@ func ListPendingPosts() ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var p Post
-		if err := rows.Scan(&p.Id, &p.UserId, &p.CategoryId, &p.Name, &p.Address, &p.Description,
-			&p.DailyPrice, &p.WeeklyPrice, &p.MonthlyPrice, &p.Status, &p.DateTime); err != nil {
+		if err := scanPost(rows, &p); err != nil {
 			return nil, err
 		}
+		posts = append(posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-		// fetch images
-		imageRows, err := db.DB.Query(`SELECT imageUrl FROM post_images WHERE postId=? ORDER BY position ASC`, p.Id)
-		if err != nil {
-			return nil, err
-		}
-		defer imageRows.Close()
+	if err := loadPostDetails(postRefs(posts)...); err != nil {
+		return nil, err
+	}
 
-		p.ImageUrls = []string{}
-		for imageRows.Next() {
-			var url string
-			if err := imageRows.Scan(&url); err != nil {
-				return nil, err
-			}
-			p.ImageUrls = append(p.ImageUrls, url)
+	return posts, nil
+}
+
+// loadPostDetails fills in the images and attribute values of the given posts
+func loadPostDetails(posts ...*Post) error {
+	if err := loadPostImages(posts...); err != nil {
+		return err
+	}
+	return loadPostAttributes(posts...)
+}
+
+// postBatchSize caps the post IDs per image or attribute query, well below
+// SQLite's limit on bound parameters
+const postBatchSize = 500
+
+// loadPostImages fills in the images of the given posts in display order,
+// reading all of them with one query per batch of posts
+func loadPostImages(posts ...*Post) error {
+	byId := make(map[int64]*Post, len(posts))
+	ids := make([]interface{}, 0, len(posts))
+	for _, p := range posts {
+		p.Images = []PostImage{}
+		if _, seen := byId[p.Id]; !seen {
+			ids = append(ids, p.Id)
 		}
+		byId[p.Id] = p
+	}
 
-		posts = append(posts, p)
+	for start := 0; start < len(ids); start += postBatchSize {
+		batch := ids[start:min(start+postBatchSize, len(ids))]
+		if err := loadPostImageBatch(batch, byId); err != nil {
+			return err
+		}
 	}
 
-	return posts, nil
+	for _, p := range byId {
+		if len(p.Images) > 0 && !slices.ContainsFunc(p.Images, func(img PostImage) bool { return img.IsCover }) {
+			p.Images[0].IsCover = true
+		}
+	}
+	return nil
 }
 
-// UpdateStatus updates the status of a post (approved/rejected)
-func UpdateStatus(postID int64, status string) error {
-	res, err := db.DB.Exec(`UPDATE posts SET status=? WHERE id=?`, status, postID)
+func loadPostImageBatch(ids []interface{}, byId map[int64]*Post) error {
+	rows, err := db.DB.Query(`
+		SELECT pi.postId, pi.id, pi.imageUrl,
+			COALESCE(u.thumbUrl, pi.imageUrl), COALESCE(u.mediumUrl, pi.imageUrl), COALESCE(u.largeUrl, pi.imageUrl),
+			COALESCE(u.width, 0), COALESCE(u.height, 0), pi.altText, pi.caption, pi.isCover
+		FROM post_images pi LEFT JOIN uploads u ON u.url = pi.imageUrl
+		WHERE pi.postId IN (`+placeholders(len(ids))+`)
+		ORDER BY pi.postId, pi.position ASC, pi.id ASC`, ids...)
 	if err != nil {
 		return err
 	}
-	rowsAffected, _ := res.RowsAffected()
-	if rowsAffected == 0 {
-		return errors.New("post not found")
+	defer rows.Close()
+
+	for rows.Next() {
+		var postId int64
+		var img PostImage
+		if err := rows.Scan(&postId, &img.Id, &img.Url, &img.ThumbUrl, &img.MediumUrl, &img.LargeUrl, &img.Width, &img.Height,
+			&img.AltText, &img.Caption, &img.IsCover); err != nil {
+			return err
+		}
+		p := byId[postId]
+		p.Images = append(p.Images, img)
 	}
-	return nil
+	return rows.Err()
+}
+
+// postRefs points into a slice of posts so loaders can fill them in place
+func postRefs(posts []Post) []*Post {
+	refs := make([]*Post, len(posts))
+	for i := range posts {
+		refs[i] = &posts[i]
+	}
+	return refs
+}
+
+// placeholders returns "?, ?, ..." for an IN list of n values
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
 }
 
+// ErrPostNotFound is returned when a post does not exist
+var ErrPostNotFound = errors.New("post not found")
+
 // GetPostStatus returns the current status of a post
 func GetPostStatus(postID int64) (string, error) {
 	var status string
 	err := db.DB.QueryRow(`SELECT status FROM posts WHERE id=?`, postID).Scan(&status)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return "", errors.New("post not found")
+			return "", ErrPostNotFound
 		}
 		return "", err
 	}
 	return status, nil
 }
 
-// ListPendingPosts returns all posts with status "pending"
-// func ListAllPosts() ([]Post, error) {
-// 	rows, err := db.DB.Query(`
-//         SELECT id, userId, categoryId, name, address, description, dailyPrice, weeklyPrice, monthlyPrice, status, dateTime
-//         FROM posts WHERE status='pending'`)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	defer rows.Close()
-// 	var posts []Post
-// 	for rows.Next() {
-// 		var p Post
-// 		if err := rows.Scan(&p.Id, &p.UserId, &p.CategoryId, &p.Name, &p.Address, &p.Description,
-// 			&p.DailyPrice, &p.WeeklyPrice, &p.MonthlyPrice, &p.Status, &p.DateTime); err != nil {
-// 			return nil, err
-// 		}
-// 		// fetch images
-// 		imageRows, err := db.DB.Query(`SELECT imageUrl FROM post_images WHERE postId=? ORDER BY position ASC`, p.Id)
-// 		if err != nil {
-// 			return nil, err
-// 		}
-// 		defer imageRows.Close()
-// 		p.ImageUrls = []string{}
-// 		for imageRows.Next() {
-// 			var url string
-// 			if err := imageRows.Scan(&url); err != nil {
-// 				return nil, err
-// 			}
-// 			p.ImageUrls = append(p.ImageUrls, url)
-// 		}
-// 		posts = append(posts, p)
-// 	}
-// 	return posts, nil
-// }
+// CanManagePost checks that the user owns the post or is an admin
+func CanManagePost(postID, userId int64, role string) error {
+	var ownerId int64
+	err := db.DB.QueryRow(`SELECT userId FROM posts WHERE id=?`, postID).Scan(&ownerId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrPostNotFound
+		}
+		return err
+	}
+	if ownerId != userId && role != "admin" && role != "superadmin" {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// AllPostsFilter selects posts of any status for admins. Zero values mean
+// "no filter"; Statuses matches any of the listed statuses.
+type AllPostsFilter struct {
+	Statuses    []string
+	OwnerId     int64
+	CategoryId  int64  // includes its subcategories
+	AddedAfter  string // YYYY-MM-DD, inclusive
+	AddedBefore string // YYYY-MM-DD, inclusive
+	Cursor      string
+	Limit       int
+}
+
+// ListAllPosts returns posts in every status, newest first, paged by cursor
+func ListAllPosts(f AllPostsFilter) (*PostPage, error) {
+	if f.Limit <= 0 {
+		f.Limit = defaultPageSize
+	}
+	if f.Limit > maxPageSize {
+		f.Limit = maxPageSize
+	}
+
+	where := []string{"1=1"}
+	var args []interface{}
+
+	if len(f.Statuses) > 0 {
+		for _, status := range f.Statuses {
+			if !IsValidPostStatus(status) {
+				return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidFilter, status)
+			}
+			args = append(args, status)
+		}
+		where = append(where, "status IN ("+placeholders(len(f.Statuses))+")")
+	}
+	if f.OwnerId != 0 {
+		where = append(where, "userId=?")
+		args = append(args, f.OwnerId)
+	}
+	if f.CategoryId != 0 { // subcategories included
+		where = append(where, "categoryId IN ("+categorySubtreeIds+")")
+		args = append(args, f.CategoryId)
+	}
+	if f.AddedAfter != "" {
+		d, err := utils.ParseDate(f.AddedAfter)
+		if err != nil {
+			return nil, fmt.Errorf("%w: addedAfter: %v", ErrInvalidFilter, err)
+		}
+		where = append(where, "date(dateTime) >= ?")
+		args = append(args, d.Format(utils.DateLayout))
+	}
+	if f.AddedBefore != "" {
+		d, err := utils.ParseDate(f.AddedBefore)
+		if err != nil {
+			return nil, fmt.Errorf("%w: addedBefore: %v", ErrInvalidFilter, err)
+		}
+		where = append(where, "date(dateTime) <= ?")
+		args = append(args, d.Format(utils.DateLayout))
+	}
+
+	page := &PostPage{Posts: []Post{}}
+	whereSQL := " WHERE " + strings.Join(where, " AND ")
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM posts"+whereSQL, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	if f.Cursor != "" {
+		c, err := decodePostCursor(f.Cursor)
+		if err != nil || c.Sort != SortNewest {
+			return nil, fmt.Errorf("%w: cursor does not match this listing", ErrInvalidFilter)
+		}
+		whereSQL += " AND id < ?"
+		args = append(args, c.Id)
+	}
+
+	// fetch one extra row to know whether another page follows
+	args = append(args, f.Limit+1)
+	rows, err := db.DB.Query(`SELECT `+postColumns+` FROM posts`+whereSQL+" ORDER BY id DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Post
+		if err := scanPost(rows, &p); err != nil {
+			return nil, err
+		}
+		page.Posts = append(page.Posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(page.Posts) > f.Limit {
+		page.Posts = page.Posts[:f.Limit]
+		page.NextCursor = encodePostCursor(postCursor{Sort: SortNewest, Id: page.Posts[f.Limit-1].Id})
+	}
+
+	if err := loadPostDetails(postRefs(page.Posts)...); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
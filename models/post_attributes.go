@@ -0,0 +1,311 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"rentx/db"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidPostAttribute is returned for attribute values that do not match
+// the attributes of the post's category
+var ErrInvalidPostAttribute = errors.New("invalid post attribute")
+
+// resolveAttributes checks the attribute values of a post against the
+// attributes of its category and normalizes them: numbers as float64,
+// booleans as bool, enums and text as trimmed strings. Attributes left out
+// on an update (nil) keep their stored values; when the category changes as
+// well, those the new category does not have are dropped. current is nil for
+// new posts.
+func (p *Post) resolveAttributes(current *Post) error {
+	kept := p.Attributes == nil && current != nil
+	if kept {
+		if p.CategoryId == current.CategoryId {
+			return nil // left as they are
+		}
+		p.Attributes = current.Attributes
+	}
+
+	schema, err := categoryAttributes(db.DB, p.CategoryId)
+	if err != nil {
+		return err
+	}
+	values := map[string]any{}
+	for key, value := range p.Attributes {
+		attribute := findAttribute(schema, key)
+		if attribute == nil {
+			if kept {
+				continue
+			}
+			return fmt.Errorf("%w: %s is not an attribute of this category", ErrInvalidPostAttribute, key)
+		}
+		value, err := attribute.validateValue(value)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			values[key] = value
+		}
+	}
+	for _, attribute := range schema {
+		if _, ok := values[attribute.Key]; attribute.Required && !ok {
+			return fmt.Errorf("%w: %s is required", ErrInvalidPostAttribute, attribute.Key)
+		}
+	}
+	p.Attributes = values
+	return nil
+}
+
+// validateValue checks one value decoded from JSON; nil and blank text mean
+// the attribute is not set
+func (a *CategoryAttribute) validateValue(value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch a.Type {
+	case AttributeNumber:
+		n, ok := value.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s must be a number", ErrInvalidPostAttribute, a.Key)
+		}
+		if a.Min != nil && n < *a.Min || a.Max != nil && n > *a.Max {
+			return nil, fmt.Errorf("%w: %s must be between %s", ErrInvalidPostAttribute, a.Key, a.numberRange())
+		}
+		return n, nil
+	case AttributeBoolean:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s must be true or false", ErrInvalidPostAttribute, a.Key)
+		}
+		return b, nil
+	case AttributeEnum:
+		s, ok := value.(string)
+		if !ok || !slices.Contains(a.Options, strings.TrimSpace(s)) {
+			return nil, fmt.Errorf("%w: %s must be one of %s", ErrInvalidPostAttribute, a.Key, strings.Join(a.Options, ", "))
+		}
+		return strings.TrimSpace(s), nil
+	default: // AttributeText
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s must be text", ErrInvalidPostAttribute, a.Key)
+		}
+		s = strings.TrimSpace(s)
+		if len([]rune(s)) > maxAttributeTextLength {
+			return nil, fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidPostAttribute, a.Key, maxAttributeTextLength)
+		}
+		if s == "" {
+			return nil, nil
+		}
+		return s, nil
+	}
+}
+
+// numberRange describes the limits of a number attribute, e.g. "2 and 9 seats"
+func (a *CategoryAttribute) numberRange() string {
+	format := func(limit *float64, none string) string {
+		if limit == nil {
+			return none
+		}
+		return strconv.FormatFloat(*limit, 'f', -1, 64)
+	}
+	return strings.TrimSpace(format(a.Min, "-∞") + " and " + format(a.Max, "∞") + " " + a.Unit)
+}
+
+// replacePostAttributes stores the normalized attribute values of a post,
+// replacing the previous ones
+func replacePostAttributes(tx *sql.Tx, postId int64, values map[string]any) error {
+	if _, err := tx.Exec("DELETE FROM post_attributes WHERE postId=?", postId); err != nil {
+		return err
+	}
+	for key, value := range values {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO post_attributes (postId, key, value) VALUES (?, ?, ?)", postId, key, string(encoded)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropRejectedAttributes deletes the attribute values of the posts filed
+// directly under the given categories that their category does not accept:
+// unknown keys and values that fail its checks, e.g. after posts moved to
+// another category. Missing required values are left for the owner to fill
+// in on their next edit. It returns how many values were deleted.
+func dropRejectedAttributes(tx *sql.Tx, categoryIds ...int64) (int64, error) {
+	type stored struct {
+		postId int64
+		key    string
+	}
+	var dropped int64
+	for _, categoryId := range categoryIds {
+		schema, err := categoryAttributes(tx, categoryId)
+		if err != nil {
+			return dropped, err
+		}
+		rows, err := tx.Query(`
+			SELECT postId, key, value FROM post_attributes
+			WHERE postId IN (SELECT id FROM posts WHERE categoryId=?)`, categoryId)
+		if err != nil {
+			return dropped, err
+		}
+		var rejected []stored
+		for rows.Next() {
+			var v stored
+			var encoded string
+			if err := rows.Scan(&v.postId, &v.key, &encoded); err != nil {
+				rows.Close()
+				return dropped, err
+			}
+			attribute := findAttribute(schema, v.key)
+			if attribute == nil {
+				rejected = append(rejected, v)
+				continue
+			}
+			var value any
+			if err := json.Unmarshal([]byte(encoded), &value); err != nil {
+				rows.Close()
+				return dropped, err
+			}
+			if value, err := attribute.validateValue(value); err != nil || value == nil {
+				rejected = append(rejected, v)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return dropped, err
+		}
+
+		for _, v := range rejected {
+			if _, err := tx.Exec("DELETE FROM post_attributes WHERE postId=? AND key=?", v.postId, v.key); err != nil {
+				return dropped, err
+			}
+			dropped++
+		}
+	}
+	return dropped, nil
+}
+
+// loadPostAttributes fills in the attribute values of the given posts with
+// one query per batch of posts
+func loadPostAttributes(posts ...*Post) error {
+	byId := make(map[int64]*Post, len(posts))
+	ids := make([]interface{}, 0, len(posts))
+	for _, p := range posts {
+		p.Attributes = map[string]any{}
+		if _, seen := byId[p.Id]; !seen {
+			ids = append(ids, p.Id)
+		}
+		byId[p.Id] = p
+	}
+
+	for start := 0; start < len(ids); start += postBatchSize {
+		batch := ids[start:min(start+postBatchSize, len(ids))]
+		rows, err := db.DB.Query("SELECT postId, key, value FROM post_attributes WHERE postId IN ("+placeholders(len(batch))+")", batch...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var postId int64
+			var key, encoded string
+			var value any
+			if err := rows.Scan(&postId, &key, &encoded); err != nil {
+				rows.Close()
+				return err
+			}
+			if err := json.Unmarshal([]byte(encoded), &value); err != nil {
+				rows.Close()
+				return err
+			}
+			byId[postId].Attributes[key] = value
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AttributeFilter matches posts by an attribute value, e.g. seats>=5
+type AttributeFilter struct {
+	Key   string
+	Op    string // = != > >= < <=
+	Value string
+}
+
+// attributeOps are the filter operators, two-character ones first so that
+// ">=" is not read as ">" followed by "=5"
+var attributeOps = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+// ParseAttributeFilter reads a filter written as key, operator and value:
+// seats>=5, fuel=diesel, automatic=true. = and != compare numbers, booleans
+// and text; the others only numbers.
+func ParseAttributeFilter(s string) (AttributeFilter, error) {
+	var f AttributeFilter
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_')
+	})
+	if end <= 0 {
+		return f, fmt.Errorf("%w: attr must look like key=value or key>=number", ErrInvalidFilter)
+	}
+	f.Key = s[:end]
+	for _, op := range attributeOps {
+		if strings.HasPrefix(s[end:], op) {
+			f.Op = op
+			f.Value = strings.TrimSpace(s[end+len(op):])
+			break
+		}
+	}
+	if f.Op == "" || f.Value == "" {
+		return f, fmt.Errorf("%w: attr %q needs an operator (= != > >= < <=) and a value", ErrInvalidFilter, s)
+	}
+	if f.Op != "=" && f.Op != "!=" {
+		if _, ok := parseFiniteNumber(f.Value); !ok {
+			return f, fmt.Errorf("%w: attr %q compares with %s, which needs a number", ErrInvalidFilter, s, f.Op)
+		}
+	}
+	return f, nil
+}
+
+// condition returns the SQL condition matching posts (named posts) that have
+// the attribute with a matching value. Stored values are JSON, so equality
+// compares against every JSON form the filter value can take.
+func (f AttributeFilter) condition() (string, []interface{}) {
+	const exists = "EXISTS (SELECT 1 FROM post_attributes pa WHERE pa.postId = posts.id AND pa.key = ? AND "
+	if f.Op != "=" && f.Op != "!=" {
+		n, _ := parseFiniteNumber(f.Value)
+		return exists + "json_type(pa.value) IN ('integer', 'real') AND CAST(pa.value AS REAL) " + f.Op + " ?)",
+			[]interface{}{f.Key, n}
+	}
+
+	text, _ := json.Marshal(f.Value)
+	forms := []interface{}{string(text)}
+	if n, ok := parseFiniteNumber(f.Value); ok {
+		number, _ := json.Marshal(n)
+		forms = append(forms, string(number))
+	}
+	if f.Value == "true" || f.Value == "false" {
+		forms = append(forms, f.Value)
+	}
+
+	in := "IN"
+	if f.Op == "!=" {
+		in = "NOT IN"
+	}
+	return exists + "pa.value " + in + " (" + placeholders(len(forms)) + "))", append([]interface{}{f.Key}, forms...)
+}
+
+// parseFiniteNumber parses a number, rejecting NaN and infinities, which
+// attribute values cannot hold
+func parseFiniteNumber(s string) (float64, bool) {
+	n, err := strconv.ParseFloat(s, 64)
+	return n, err == nil && !math.IsNaN(n) && !math.IsInf(n, 0)
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// newTestAttribute adds an attribute to a category
+func newTestAttribute(t *testing.T, categoryId int64, a CategoryAttribute) {
+	t.Helper()
+	a.CategoryId = categoryId
+	if a.Label == "" {
+		a.Label = a.Key
+	}
+	if err := a.Save(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTestPostWithAttributes saves an approved post of ownerId in a category
+func newTestPostWithAttributes(t *testing.T, ownerId, categoryId int64, attributes map[string]any) *Post {
+	t.Helper()
+	p := &Post{
+		UserId:      ownerId,
+		CategoryId:  categoryId,
+		Name:        "Car",
+		Address:     "Main Street 1",
+		Description: "A car",
+		DailyPrice:  50,
+		Attributes:  attributes,
+	}
+	if err := p.Save("admin"); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func postAttributes(t *testing.T, postId int64) map[string]any {
+	t.Helper()
+	p, err := getPost(postId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Attributes
+}
+
+func TestParseAttributeFilter(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want AttributeFilter
+	}{
+		{"seats>=5", AttributeFilter{"seats", ">=", "5"}},
+		{"seats>5", AttributeFilter{"seats", ">", "5"}},
+		{"seats<=2.5", AttributeFilter{"seats", "<=", "2.5"}},
+		{"seats<2", AttributeFilter{"seats", "<", "2"}},
+		{"fuel!=diesel", AttributeFilter{"fuel", "!=", "diesel"}},
+		{"fuel=diesel", AttributeFilter{"fuel", "=", "diesel"}},
+		{"fuel= diesel ", AttributeFilter{"fuel", "=", "diesel"}},
+		{"note==x", AttributeFilter{"note", "=", "=x"}},
+		{"automatic=true", AttributeFilter{"automatic", "=", "true"}},
+		{"max_load_2=-1e3", AttributeFilter{"max_load_2", "=", "-1e3"}},
+	} {
+		got, err := ParseAttributeFilter(c.in)
+		if err != nil || got != c.want {
+			t.Errorf("ParseAttributeFilter(%q) = %+v, %v, want %+v", c.in, got, err, c.want)
+		}
+	}
+
+	for _, in := range []string{"", "=5", "seats", "seats>", "seats=", "Seats=5", "seats~5", "seats>=five", "seats>NaN", "seats<Inf"} {
+		if _, err := ParseAttributeFilter(in); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("ParseAttributeFilter(%q): err = %v, want ErrInvalidFilter", in, err)
+		}
+	}
+}
+
+func TestAttributeFilterCondition(t *testing.T) {
+	category := newTestCategory(t, "Cars", nil)
+	newTestAttribute(t, category.Id, CategoryAttribute{Key: "seats", Type: AttributeNumber})
+	newTestAttribute(t, category.Id, CategoryAttribute{Key: "fuel", Type: AttributeEnum, Options: []string{"diesel", "petrol"}})
+	newTestAttribute(t, category.Id, CategoryAttribute{Key: "automatic", Type: AttributeBoolean})
+	newTestAttribute(t, category.Id, CategoryAttribute{Key: "note", Type: AttributeText})
+
+	ownerId := newTestUser(t)
+	a := newTestPostWithAttributes(t, ownerId, category.Id, map[string]any{"seats": 5.0, "fuel": "diesel", "automatic": true, "note": "5"})
+	b := newTestPostWithAttributes(t, ownerId, category.Id, map[string]any{"seats": 2.0, "fuel": "petrol", "automatic": false, "note": "true"})
+	none := newTestPostWithAttributes(t, ownerId, category.Id, nil)
+
+	for _, c := range []struct {
+		filter string
+		want   []*Post
+	}{
+		{"seats=5", []*Post{a}},
+		{"seats=5.0", []*Post{a}},
+		{"seats!=5", []*Post{b}},
+		{"note=5", []*Post{a}},
+		{"automatic=true", []*Post{a}},
+		{"automatic!=true", []*Post{b}},
+		{"note=true", []*Post{b}},
+		{"fuel=diesel", []*Post{a}},
+		{"fuel=Diesel", nil},
+		{"fuel!=diesel", []*Post{b}},
+		{"seats>2", []*Post{a}},
+		{"seats>=2", []*Post{a, b}},
+		{"seats<5", []*Post{b}},
+		{"seats<=5", []*Post{a, b}},
+		{"note>4", nil}, // text is never compared as a number
+		{"missing=1", nil},
+	} {
+		f, err := ParseAttributeFilter(c.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := SearchApprovedPosts(PostFilter{OwnerId: ownerId, Attributes: []AttributeFilter{f}, Sort: SortNewest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, want []int64
+		for _, p := range page.Posts {
+			got = append(got, p.Id)
+		}
+		for _, p := range c.want {
+			want = append(want, p.Id)
+		}
+		slices.Sort(got)
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: posts %v, want %v (a=%d, b=%d, none=%d)", c.filter, got, want, a.Id, b.Id, none.Id)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"fmt"
+	"html"
+	"rentx/db"
+	"strings"
+	"unicode"
+)
+
+// PostSearchHit is an approved post matching a full-text query. Highlighted
+// fields are HTML-escaped with matches wrapped in <mark> tags.
+type PostSearchHit struct {
+	Post
+	HighlightedName string  `json:"highlightedName"`
+	Snippet         string  `json:"snippet"`
+	Rank            float64 `json:"rank"` // bm25, lower is better
+}
+
+// PostSearchResults is one page of full-text search hits
+type PostSearchResults struct {
+	Results []PostSearchHit `json:"results"`
+	Total   int             `json:"total"`
+}
+
+// markers wrap matches inside SQLite; they are private-use runes so that the
+// post text can be HTML-escaped before they are turned into <mark> tags
+const (
+	markOpen  = "\uE000"
+	markClose = "\uE001"
+)
+
+// FullTextSearchPosts ranks approved posts against a query over name,
+// description and address. Bare words must all match; "double quotes"
+// match a phrase; a trailing * matches a prefix (e.g. cam*).
+func FullTextSearchPosts(query string, limit, offset int) (*PostSearchResults, error) {
+	match, err := buildMatchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	results := &PostSearchResults{Results: []PostSearchHit{}}
+	err = db.DB.QueryRow(`
+		SELECT COUNT(*) FROM posts_fts JOIN posts ON posts.id = posts_fts.rowid
+		WHERE posts_fts MATCH ? AND posts.status='approved'`, match).Scan(&results.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	// name matches weigh most, then description, then address
+	rows, err := db.DB.Query(`
+		SELECT `+postColumns+`,
+			highlight(posts_fts, 0, ?, ?),
+			snippet(posts_fts, -1, ?, ?, '…', 16),
+			bm25(posts_fts, 10.0, 3.0, 1.0) AS rank
+		FROM posts_fts JOIN posts ON posts.id = posts_fts.rowid
+		WHERE posts_fts MATCH ? AND posts.status='approved'
+		ORDER BY rank, posts.id DESC
+		LIMIT ? OFFSET ?`,
+		markOpen, markClose, markOpen, markClose, match, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var h PostSearchHit
+		if err := scanPost(rows, &h.Post, &h.HighlightedName, &h.Snippet, &h.Rank); err != nil {
+			return nil, err
+		}
+		h.HighlightedName = markToHTML(h.HighlightedName)
+		h.Snippet = markToHTML(h.Snippet)
+		results.Results = append(results.Results, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	posts := make([]*Post, len(results.Results))
+	for i := range results.Results {
+		posts[i] = &results.Results[i].Post
+	}
+	if err := loadPostDetails(posts...); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// buildMatchQuery turns user input into a safe FTS5 MATCH expression: every
+// term is quoted so FTS5 operators and column filters in the input are inert
+func buildMatchQuery(input string) (string, error) {
+	var terms []string
+	rest := strings.TrimSpace(input)
+
+	for rest != "" {
+		var term string
+		if rest[0] == '"' {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				term, rest = rest[1:], ""
+			} else {
+				term, rest = rest[1:end+1], rest[end+2:]
+			}
+			if strings.HasPrefix(rest, "*") {
+				term, rest = term+"*", rest[1:]
+			}
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				term, rest = rest, ""
+			} else {
+				term, rest = rest[:end], rest[end:]
+			}
+		}
+		rest = strings.TrimSpace(rest)
+
+		words := strings.FieldsFunc(term, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		if len(words) == 0 {
+			continue
+		}
+
+		quoted := `"` + strings.Join(words, " ") + `"`
+		if strings.HasSuffix(term, "*") {
+			quoted += "*"
+		}
+		terms = append(terms, quoted)
+	}
+
+	if len(terms) == 0 {
+		return "", fmt.Errorf("%w: search query must contain letters or digits", ErrInvalidFilter)
+	}
+	return strings.Join(terms, " "), nil
+}
+
+func markToHTML(s string) string {
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, markOpen, "<mark>")
+	return strings.ReplaceAll(s, markClose, "</mark>")
+}
@@ -0,0 +1,323 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"rentx/db"
+	"strings"
+)
+
+// Limits on image text
+const (
+	maxAltTextLength = 250
+	maxCaptionLength = 500
+)
+
+var (
+	ErrPostImageNotFound = errors.New("post image not found")
+	ErrInvalidPostImage  = errors.New("invalid post image")
+)
+
+// PostImageInput adds one image to a post
+type PostImageInput struct {
+	Url     string `json:"url" binding:"required"`
+	AltText string `json:"altText"`
+	Caption string `json:"caption"`
+}
+
+// PostImageText edits the text of an image; nil fields are left unchanged
+type PostImageText struct {
+	AltText *string `json:"altText"`
+	Caption *string `json:"caption"`
+}
+
+// ListPostImages returns the images of a post in display order
+func ListPostImages(postId int64) ([]PostImage, error) {
+	p := &Post{Id: postId}
+	if err := loadPostImages(p); err != nil {
+		return nil, err
+	}
+	return p.Images, nil
+}
+
+// AddPostImage appends one of the caller's uploads to a post. Like a content
+// edit, an owner adding an image sends an approved post back to review.
+func AddPostImage(postId int64, in PostImageInput, userId int64, role string) (*PostImage, error) {
+	in.Url = strings.TrimSpace(in.Url)
+	if in.Url == "" {
+		return nil, fmt.Errorf("%w: url is required", ErrInvalidPostImage)
+	}
+	if err := validateImageText(&in.AltText, &in.Caption); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var onPost bool
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM post_images WHERE postId=? AND imageUrl=?)", postId, in.Url).Scan(&onPost)
+	if err != nil {
+		return nil, err
+	}
+	if onPost {
+		return nil, fmt.Errorf("%w: the image is already on the post", ErrInvalidPostImage)
+	}
+	if err := checkImageOwnership(tx, postId, userId, []string{in.Url}); err != nil {
+		return nil, err
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO post_images (postId, imageUrl, position, altText, caption)
+		VALUES (?, ?, (SELECT COALESCE(MAX(position), -1) + 1 FROM post_images WHERE postId=?), ?, ?)`,
+		postId, in.Url, postId, in.AltText, in.Caption)
+	if err != nil {
+		return nil, err
+	}
+	imageId, _ := res.LastInsertId()
+
+	if err := sendBackForReview(tx, postId, userId, role); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return getPostImage(postId, imageId)
+}
+
+// UpdatePostImageText sets the alt text and/or caption of an image. Changed
+// text from an owner sends an approved post back to review.
+func UpdatePostImageText(postId, imageId int64, text PostImageText, userId int64, role string) (*PostImage, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var altText, caption string
+	err = tx.QueryRow("SELECT altText, caption FROM post_images WHERE id=? AND postId=?", imageId, postId).Scan(&altText, &caption)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPostImageNotFound
+		}
+		return nil, err
+	}
+
+	newAltText, newCaption := altText, caption
+	if text.AltText != nil {
+		newAltText = *text.AltText
+	}
+	if text.Caption != nil {
+		newCaption = *text.Caption
+	}
+	if err := validateImageText(&newAltText, &newCaption); err != nil {
+		return nil, err
+	}
+
+	if newAltText != altText || newCaption != caption {
+		if _, err := tx.Exec("UPDATE post_images SET altText=?, caption=? WHERE id=?", newAltText, newCaption, imageId); err != nil {
+			return nil, err
+		}
+		if err := sendBackForReview(tx, postId, userId, role); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return getPostImage(postId, imageId)
+}
+
+// RemovePostImage takes an image off a post. The uploaded file stays until
+// no post uses it (see SweepOrphanedUploads).
+func RemovePostImage(postId, imageId int64) error {
+	res, err := db.DB.Exec("DELETE FROM post_images WHERE id=? AND postId=?", imageId, postId)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrPostImageNotFound
+	}
+	return nil
+}
+
+// ReorderPostImages puts the images of a post in the given order, which must
+// list every image of the post exactly once
+func ReorderPostImages(postId int64, imageIds []int64) ([]PostImage, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	current, err := postImageIds(tx, postId)
+	if err != nil {
+		return nil, err
+	}
+	if len(imageIds) != len(current) {
+		return nil, fmt.Errorf("%w: imageIds must list all %d images of the post", ErrInvalidPostImage, len(current))
+	}
+	seen := make(map[int64]bool, len(imageIds))
+	for _, id := range imageIds {
+		if !current[id] || seen[id] {
+			return nil, fmt.Errorf("%w: imageIds must list every image of the post once", ErrInvalidPostImage)
+		}
+		seen[id] = true
+	}
+
+	for position, id := range imageIds {
+		if _, err := tx.Exec("UPDATE post_images SET position=? WHERE id=?", position, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ListPostImages(postId)
+}
+
+// SetPostCoverImage makes an image the one shown for the post in listings
+func SetPostCoverImage(postId, imageId int64) ([]PostImage, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// cleared first: the one-cover-per-post index is checked row by row
+	if _, err := tx.Exec("UPDATE post_images SET isCover=0 WHERE postId=? AND isCover=1", postId); err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec("UPDATE post_images SET isCover=1 WHERE id=? AND postId=?", imageId, postId)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrPostImageNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ListPostImages(postId)
+}
+
+// replacePostImages makes the images of a post match urls in order. Images
+// that stay keep their id, text and cover flag; new ones are added and the
+// rest removed. Blank and repeated URLs are skipped.
+func replacePostImages(tx *sql.Tx, postId int64, urls []string) error {
+	rows, err := tx.Query("SELECT id, imageUrl FROM post_images WHERE postId=? ORDER BY position, id", postId)
+	if err != nil {
+		return err
+	}
+	existing := map[string]int64{}
+	var duplicates []int64
+	for rows.Next() {
+		var id int64
+		var url string
+		if err := rows.Scan(&id, &url); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, ok := existing[url]; ok {
+			duplicates = append(duplicates, id)
+			continue
+		}
+		existing[url] = id
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	position := 0
+	for _, url := range nonEmpty(urls) {
+		id, ok := existing[url]
+		switch {
+		case ok && id == 0:
+			continue // repeated in urls
+		case ok:
+			_, err = tx.Exec("UPDATE post_images SET position=? WHERE id=?", position, id)
+		default:
+			_, err = tx.Exec("INSERT INTO post_images (postId, imageUrl, position) VALUES (?, ?, ?)", postId, url, position)
+		}
+		if err != nil {
+			return err
+		}
+		existing[url] = 0 // kept
+		position++
+	}
+
+	for _, id := range existing {
+		if id != 0 {
+			duplicates = append(duplicates, id)
+		}
+	}
+	for _, id := range duplicates {
+		if _, err := tx.Exec("DELETE FROM post_images WHERE id=?", id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendBackForReview moves an approved post to pending when its owner changes
+// what moderators review, as Post.Update does for content edits
+func sendBackForReview(tx *sql.Tx, postId, actorId int64, role string) error {
+	if role == "admin" || role == "superadmin" {
+		return nil
+	}
+	res, err := tx.Exec("UPDATE posts SET status=? WHERE id=? AND status=?", PostPending, postId, PostApproved)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	return recordPostModeration(tx, postId, PostApproved, PostPending, reasonContentEdited, actorId)
+}
+
+func getPostImage(postId, imageId int64) (*PostImage, error) {
+	images, err := ListPostImages(postId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range images {
+		if images[i].Id == imageId {
+			return &images[i], nil
+		}
+	}
+	return nil, ErrPostImageNotFound
+}
+
+func postImageIds(tx *sql.Tx, postId int64) (map[int64]bool, error) {
+	rows, err := tx.Query("SELECT id FROM post_images WHERE postId=?", postId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+func validateImageText(altText, caption *string) error {
+	*altText = strings.TrimSpace(*altText)
+	*caption = strings.TrimSpace(*caption)
+	if len([]rune(*altText)) > maxAltTextLength {
+		return fmt.Errorf("%w: alt text is longer than %d characters", ErrInvalidPostImage, maxAltTextLength)
+	}
+	if len([]rune(*caption)) > maxCaptionLength {
+		return fmt.Errorf("%w: caption is longer than %d characters", ErrInvalidPostImage, maxCaptionLength)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"rentx/db"
+	"strings"
+)
+
+// Post statuses
+const (
+	PostDraft    = "draft" // private to the owner, not yet submitted
+	PostPending  = "pending"
+	PostApproved = "approved"
+	PostRejected = "rejected"
+	PostArchived = "archived" // hidden by an admin without deleting it
+)
+
+// postTransitions maps current status → next status → party allowed to make the move.
+// Admins may perform any listed transition. An owner's content edit of an
+// approved post sends it back to pending automatically (see Post.Update).
+var postTransitions = map[string]map[string]string{
+	PostDraft: {
+		PostPending: actorOwner, // submitted for review
+	},
+	PostPending: {
+		PostApproved: actorAdmin,
+		PostRejected: actorAdmin,
+		PostArchived: actorAdmin,
+	},
+	PostApproved: {
+		PostRejected: actorAdmin, // taken down after publication
+		PostArchived: actorAdmin,
+	},
+	PostRejected: {
+		PostApproved: actorAdmin,
+		PostPending:  actorOwner, // resubmitted after edits
+		PostArchived: actorAdmin,
+	},
+	PostArchived: {
+		PostApproved: actorAdmin, // restored
+	},
+}
+
+const actorAdmin = "admin"
+
+// reasonContentEdited is recorded when an edit sends an approved post back to review
+const reasonContentEdited = "content edited"
+
+var (
+	ErrInvalidPostTransition = errors.New("invalid post status transition")
+	ErrReasonRequired        = errors.New("a reason is required to reject a post")
+	ErrInvalidBulkAction     = errors.New("invalid bulk action")
+)
+
+// PostModerationChange is one entry of a post's moderation history
+type PostModerationChange struct {
+	Id         int64  `json:"id"`
+	PostId     int64  `json:"postId"`
+	FromStatus string `json:"fromStatus"`
+	ToStatus   string `json:"toStatus"`
+	Reason     string `json:"reason"`
+	ActorId    int64  `json:"actorId"`
+	DateTime   string `json:"dateTime"`
+}
+
+// IsValidPostStatus reports whether status is a known post status
+func IsValidPostStatus(status string) bool {
+	switch status {
+	case PostDraft, PostPending, PostApproved, PostRejected, PostArchived:
+		return true
+	}
+	return false
+}
+
+// ModeratePost moves a post to a new status if the transition is allowed for
+// the acting user, and records it in the moderation history. Rejections need
+// a reason, which is kept on the post until it is resubmitted or approved.
+func ModeratePost(postId int64, toStatus, reason string, actorId int64, role string) error {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := moderatePost(tx, postId, toStatus, reason, actorId, role); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func moderatePost(tx *sql.Tx, postId int64, toStatus, reason string, actorId int64, role string) error {
+	reason = strings.TrimSpace(reason)
+	if toStatus == PostRejected && reason == "" {
+		return ErrReasonRequired
+	}
+
+	var ownerId int64
+	var fromStatus string
+	err := tx.QueryRow("SELECT userId, status FROM posts WHERE id=?", postId).Scan(&ownerId, &fromStatus)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrPostNotFound
+		}
+		return err
+	}
+
+	isAdmin := role == "admin" || role == "superadmin"
+	if actorId != ownerId && !isAdmin {
+		return ErrUnauthorized
+	}
+
+	party, ok := postTransitions[fromStatus][toStatus]
+	if !ok {
+		return fmt.Errorf("%w: cannot move post from %s to %s", ErrInvalidPostTransition, fromStatus, toStatus)
+	}
+	if party == actorAdmin && !isAdmin {
+		return fmt.Errorf("%w: only an admin can move a post to %s", ErrUnauthorized, toStatus)
+	}
+
+	moderationReason := ""
+	if toStatus == PostRejected {
+		moderationReason = reason
+	}
+	if _, err := tx.Exec("UPDATE posts SET status=?, moderationReason=? WHERE id=?",
+		toStatus, moderationReason, postId); err != nil {
+		return err
+	}
+	return recordPostModeration(tx, postId, fromStatus, toStatus, reason, actorId)
+}
+
+// Bulk moderation actions
+const (
+	BulkApprove = "approve"
+	BulkReject  = "reject"
+	BulkArchive = "archive"
+	BulkDelete  = "delete"
+)
+
+// MaxBulkPosts caps the posts of one bulk action
+const MaxBulkPosts = 100
+
+var bulkActionStatuses = map[string]string{
+	BulkApprove: PostApproved,
+	BulkReject:  PostRejected,
+	BulkArchive: PostArchived,
+}
+
+// BulkResult is the outcome of a bulk action for one post
+type BulkResult struct {
+	PostId int64  `json:"postId"`
+	Ok     bool   `json:"ok"`
+	Status string `json:"status,omitempty"` // new status; empty after delete
+	Error  string `json:"error,omitempty"`
+}
+
+// BulkModeratePosts applies one admin action to many posts in a single
+// transaction. Posts the action does not apply to (missing, or an invalid
+// transition) are reported and skipped; the others are committed together.
+func BulkModeratePosts(action string, postIds []int64, reason string, actorId int64, role string) ([]BulkResult, error) {
+	toStatus, isStatusAction := bulkActionStatuses[action]
+	if !isStatusAction && action != BulkDelete {
+		return nil, fmt.Errorf("%w: action must be approve, reject, archive or delete", ErrInvalidBulkAction)
+	}
+	if len(postIds) == 0 || len(postIds) > MaxBulkPosts {
+		return nil, fmt.Errorf("%w: between 1 and %d posts per bulk action", ErrInvalidBulkAction, MaxBulkPosts)
+	}
+	if action == BulkReject && strings.TrimSpace(reason) == "" {
+		return nil, ErrReasonRequired
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results := []BulkResult{}
+	seen := map[int64]bool{}
+	for _, id := range postIds {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var err error
+		if isStatusAction {
+			err = moderatePost(tx, id, toStatus, reason, actorId, role)
+		} else {
+			err = deletePostTx(tx, id)
+		}
+
+		result := BulkResult{PostId: id, Ok: err == nil}
+		switch {
+		case err == nil:
+			result.Status = toStatus
+		case errors.Is(err, ErrPostNotFound), errors.Is(err, ErrInvalidPostTransition), errors.Is(err, ErrUnauthorized):
+			result.Error = err.Error()
+		default:
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, tx.Commit()
+}
+
+func deletePostTx(tx *sql.Tx, postId int64) error {
+	res, err := tx.Exec("DELETE FROM posts WHERE id=?", postId)
+	if err != nil {
+		return err
+	}
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		return ErrPostNotFound
+	}
+	return nil
+}
+
+// ListPostModerationHistory returns the moderation decisions of a post, oldest first
+func ListPostModerationHistory(postId int64) ([]PostModerationChange, error) {
+	rows, err := db.DB.Query(`
+		SELECT id, postId, fromStatus, toStatus, reason, actorId, dateTime
+		FROM post_moderation_history WHERE postId=? ORDER BY id ASC`, postId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []PostModerationChange{}
+	for rows.Next() {
+		var h PostModerationChange
+		if err := rows.Scan(&h.Id, &h.PostId, &h.FromStatus, &h.ToStatus, &h.Reason, &h.ActorId, &h.DateTime); err != nil {
+			return nil, err
+		}
+		history = append(history, h)
+	}
+	return history, rows.Err()
+}
+
+func recordPostModeration(tx *sql.Tx, postId int64, fromStatus, toStatus, reason string, actorId int64) error {
+	_, err := tx.Exec(`
+		INSERT INTO post_moderation_history (postId, fromStatus, toStatus, reason, actorId)
+		VALUES (?, ?, ?, ?, ?)`, postId, fromStatus, toStatus, reason, actorId)
+	return err
+}
+
+// contentChanged reports whether an edit touches what moderators review.
+// Of the images only additions count, as with AddPostImage: reordering or
+// removing approved images shows nothing new.
+func contentChanged(before, after *Post) bool {
+	if before.CategoryId != after.CategoryId || before.Name != after.Name ||
+		before.Address != after.Address || before.Description != after.Description {
+		return true
+	}
+	if after.Attributes != nil && !maps.Equal(before.Attributes, after.Attributes) {
+		return true
+	}
+	if after.ImageUrls == nil { // images left as they are
+		return false
+	}
+	approved := make(map[string]bool, len(before.Images))
+	for _, img := range before.Images {
+		approved[img.Url] = true
+	}
+	for _, url := range nonEmpty(after.ImageUrls) {
+		if !approved[url] {
+			return true
+		}
+	}
+	return false
+}
+
+// nonEmpty drops blank entries, which are skipped when images are stored
+func nonEmpty(urls []string) []string {
+	out := make([]string, 0, len(urls))
+	for _, u := range urls {
+		if u != "" {
+			out = append(out, u)
+		}
+	}
+	return out
+}
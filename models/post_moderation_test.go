@@ -0,0 +1,93 @@
+package models
+
+import "testing"
+
+// newApprovedPostWithImages saves an approved post of a new owner with three
+// uploaded images; the owner may upload more with newTestUpload
+func newApprovedPostWithImages(t *testing.T) (*Post, int64) {
+	t.Helper()
+	ownerId := newTestUser(t)
+	post := newTestPost(t, ownerId, newTestUpload(t, ownerId), newTestUpload(t, ownerId), newTestUpload(t, ownerId))
+	if post.Status != PostApproved {
+		t.Fatalf("Status = %s, want %s", post.Status, PostApproved)
+	}
+	return post, ownerId
+}
+
+func imageUrls(p *Post) []string {
+	urls := make([]string, len(p.Images))
+	for i, img := range p.Images {
+		urls[i] = img.Url
+	}
+	return urls
+}
+
+func postStatus(t *testing.T, postId int64) string {
+	t.Helper()
+	status, err := GetPostStatus(postId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestOwnerImageEditsSendBackOnlyAdditions(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		edit func(urls []string, newUrl string) []string
+		want string
+	}{
+		{"reordered", func(urls []string, _ string) []string {
+			return []string{urls[2], urls[0], urls[1]}
+		}, PostApproved},
+		{"removed", func(urls []string, _ string) []string {
+			return urls[1:]
+		}, PostApproved},
+		{"all removed", func([]string, string) []string {
+			return []string{}
+		}, PostApproved},
+		{"added", func(urls []string, newUrl string) []string {
+			return append(urls, newUrl)
+		}, PostPending},
+		{"one replaced", func(urls []string, newUrl string) []string {
+			return []string{urls[0], newUrl}
+		}, PostPending},
+	} {
+		post, ownerId := newApprovedPostWithImages(t)
+		edit := *post
+		edit.ImageUrls = c.edit(imageUrls(post), newTestUpload(t, ownerId))
+		edit.Attributes = nil
+		if err := edit.Update(ownerId, "user"); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got := postStatus(t, post.Id); got != c.want {
+			t.Errorf("%s: status = %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestOwnerImageEndpointsSendBackOnlyAdditions(t *testing.T) {
+	post, _ := newApprovedPostWithImages(t)
+	ids := []int64{post.Images[2].Id, post.Images[0].Id, post.Images[1].Id}
+	if _, err := ReorderPostImages(post.Id, ids); err != nil {
+		t.Fatal(err)
+	}
+	if got := postStatus(t, post.Id); got != PostApproved {
+		t.Errorf("after reorder: status = %s, want %s", got, PostApproved)
+	}
+
+	if err := RemovePostImage(post.Id, post.Images[1].Id); err != nil {
+		t.Fatal(err)
+	}
+	if got := postStatus(t, post.Id); got != PostApproved {
+		t.Errorf("after remove: status = %s, want %s", got, PostApproved)
+	}
+
+	post, ownerId := newApprovedPostWithImages(t)
+	if _, err := AddPostImage(post.Id, PostImageInput{Url: newTestUpload(t, ownerId)}, ownerId, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if got := postStatus(t, post.Id); got != PostPending {
+		t.Errorf("after add: status = %s, want %s", got, PostPending)
+	}
+}
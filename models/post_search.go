@@ -0,0 +1,327 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"rentx/db"
+	"rentx/geo"
+	"rentx/utils"
+	"strings"
+)
+
+// Sort orders for post search
+const (
+	SortNewest    = "newest"
+	SortPriceAsc  = "price_asc"
+	SortPriceDesc = "price_desc"
+	SortDistance  = "distance" // nearest first; needs a point or bounding box
+	SortRating    = "rating"   // best rated first, then most rated; unrated posts last
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	defaultRadiusKm = 25
+	maxRadiusKm     = 500
+)
+
+// PostFilter holds the search parameters for approved posts. Zero values
+// mean "no filter"; prices apply to the rate of PricePeriod.
+type PostFilter struct {
+	CategoryId  int64 // includes its subcategories
+	OwnerId     int64
+	Keyword     string
+	Attributes  []AttributeFilter // all must match
+	PricePeriod string            // "daily" (default) | "weekly" | "monthly"
+	MinPrice    *float64
+	MaxPrice    *float64
+	AddedAfter  string // YYYY-MM-DD, inclusive
+	AddedBefore string // YYYY-MM-DD, inclusive
+	Near        *geo.Point
+	RadiusKm    float64 // around Near; defaults to defaultRadiusKm
+	BBox        *geo.BBox
+	Sort        string
+	Cursor      string
+	Limit       int
+}
+
+// PostPage is one page of search results. NextCursor is empty on the last page.
+type PostPage struct {
+	Posts      []Post `json:"posts"`
+	NextCursor string `json:"nextCursor"`
+	Total      int    `json:"total"`
+}
+
+// postCursor is the keyset position after the last post of a page
+type postCursor struct {
+	Sort     string  `json:"s"`
+	Price    float64 `json:"p,omitempty"`
+	Distance float64 `json:"d,omitempty"`
+	Rating   float64 `json:"r,omitempty"`
+	Count    int     `json:"c,omitempty"`
+	Id       int64   `json:"id"`
+}
+
+// distanceSQL is the haversine distance in km from a point (lat, lat, lng
+// arguments) to a post; NULL for posts without coordinates
+const distanceSQL = `6371.0 * 2 * asin(min(1.0, sqrt(
+	pow(sin(radians(latitude - ?) / 2), 2) +
+	cos(radians(?)) * cos(radians(latitude)) * pow(sin(radians(longitude - ?) / 2), 2))))`
+
+var pricePeriodColumns = map[string]string{
+	"daily":   "dailyPrice",
+	"weekly":  "weeklyPrice",
+	"monthly": "monthlyPrice",
+}
+
+// SearchApprovedPosts filters, sorts and pages approved posts using keyset
+// (cursor) pagination so pages stay stable while posts are added. With a
+// point (Near) or a bounding box, posts carry their distance from the point,
+// or from the box center, and are sorted nearest first by default.
+func SearchApprovedPosts(f PostFilter) (*PostPage, error) {
+	if f.PricePeriod == "" {
+		f.PricePeriod = "daily"
+	}
+	priceColumn, ok := pricePeriodColumns[f.PricePeriod]
+	if !ok {
+		return nil, fmt.Errorf("%w: period must be daily, weekly or monthly", ErrInvalidFilter)
+	}
+
+	// reference point for distances
+	origin := f.Near
+	if origin != nil && !origin.Valid() {
+		return nil, fmt.Errorf("%w: lat must be within ±90 and lng within ±180", ErrInvalidFilter)
+	}
+	if f.BBox != nil {
+		if !f.BBox.Valid() {
+			return nil, fmt.Errorf("%w: bbox must be minLat,minLng,maxLat,maxLng with minLat <= maxLat", ErrInvalidFilter)
+		}
+		if origin == nil {
+			center := f.BBox.Center()
+			origin = &center
+		}
+	}
+
+	if f.Sort == "" {
+		f.Sort = SortNewest
+		if origin != nil {
+			f.Sort = SortDistance
+		}
+	}
+	switch f.Sort {
+	case SortNewest, SortPriceAsc, SortPriceDesc, SortRating:
+	case SortDistance:
+		if origin == nil {
+			return nil, fmt.Errorf("%w: sort=distance needs lat/lng or bbox", ErrInvalidFilter)
+		}
+	default:
+		return nil, fmt.Errorf("%w: sort must be newest, price_asc, price_desc, distance or rating", ErrInvalidFilter)
+	}
+	if f.Limit <= 0 {
+		f.Limit = defaultPageSize
+	}
+	if f.Limit > maxPageSize {
+		f.Limit = maxPageSize
+	}
+
+	// with an origin, posts are read through a subquery that adds distanceKm
+	from, distanceColumn := "posts", "NULL"
+	var args []interface{}
+	if origin != nil {
+		from = "(SELECT *, " + distanceSQL + " AS distanceKm FROM posts) AS posts"
+		distanceColumn = "posts.distanceKm"
+		args = append(args, origin.Lat, origin.Lat, origin.Lng)
+	}
+
+	where := []string{"status='approved'"}
+
+	if f.CategoryId != 0 { // subcategories included
+		where = append(where, "categoryId IN ("+categorySubtreeIds+")")
+		args = append(args, f.CategoryId)
+	}
+	if f.OwnerId != 0 {
+		where = append(where, "userId=?")
+		args = append(args, f.OwnerId)
+	}
+	for _, attr := range f.Attributes {
+		cond, attrArgs := attr.condition()
+		where = append(where, cond)
+		args = append(args, attrArgs...)
+	}
+	if kw := strings.TrimSpace(f.Keyword); kw != "" {
+		pattern := "%" + escapeLike(kw) + "%"
+		where = append(where, `(name LIKE ? ESCAPE '\' OR description LIKE ? ESCAPE '\' OR address LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern)
+	}
+	if f.MinPrice != nil {
+		where = append(where, priceColumn+" >= ?")
+		args = append(args, *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		where = append(where, priceColumn+" <= ?")
+		args = append(args, *f.MaxPrice)
+	}
+	if f.AddedAfter != "" {
+		d, err := utils.ParseDate(f.AddedAfter)
+		if err != nil {
+			return nil, fmt.Errorf("%w: addedAfter: %v", ErrInvalidFilter, err)
+		}
+		where = append(where, "date(dateTime) >= ?")
+		args = append(args, d.Format(utils.DateLayout))
+	}
+	if f.AddedBefore != "" {
+		d, err := utils.ParseDate(f.AddedBefore)
+		if err != nil {
+			return nil, fmt.Errorf("%w: addedBefore: %v", ErrInvalidFilter, err)
+		}
+		where = append(where, "date(dateTime) <= ?")
+		args = append(args, d.Format(utils.DateLayout))
+	}
+	if f.BBox != nil {
+		cond, bboxArgs := bboxCondition(*f.BBox)
+		where = append(where, cond)
+		args = append(args, bboxArgs...)
+	}
+	if f.Near != nil {
+		if f.RadiusKm == 0 {
+			f.RadiusKm = defaultRadiusKm
+		}
+		if !(f.RadiusKm > 0 && f.RadiusKm <= maxRadiusKm) { // NaN fails too
+			return nil, fmt.Errorf("%w: radiusKm must be between 0 and %d", ErrInvalidFilter, maxRadiusKm)
+		}
+		// the bounding box lets the coordinates index narrow the candidates
+		cond, bboxArgs := bboxCondition(geo.BoundingBox(*f.Near, f.RadiusKm))
+		where = append(where, cond, "distanceKm <= ?")
+		args = append(args, append(bboxArgs, f.RadiusKm)...)
+	}
+
+	page := &PostPage{Posts: []Post{}}
+	whereSQL := " WHERE " + strings.Join(where, " AND ")
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM "+from+whereSQL, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+
+	// keyset condition and order; id breaks ties and equals insertion order
+	var orderBy string
+	switch f.Sort {
+	case SortNewest:
+		orderBy = "id DESC"
+	case SortPriceAsc:
+		orderBy = priceColumn + " ASC, id ASC"
+	case SortPriceDesc:
+		orderBy = priceColumn + " DESC, id DESC"
+	case SortDistance:
+		orderBy = "distanceKm ASC, id ASC"
+	case SortRating:
+		orderBy = "ratingAverage DESC, ratingCount DESC, id DESC"
+	}
+	if f.Cursor != "" {
+		c, err := decodePostCursor(f.Cursor)
+		if err != nil || c.Sort != f.Sort {
+			return nil, fmt.Errorf("%w: cursor does not match this search", ErrInvalidFilter)
+		}
+		switch f.Sort {
+		case SortNewest:
+			whereSQL += " AND id < ?"
+			args = append(args, c.Id)
+		case SortPriceAsc:
+			whereSQL += fmt.Sprintf(" AND (%[1]s > ? OR (%[1]s = ? AND id > ?))", priceColumn)
+			args = append(args, c.Price, c.Price, c.Id)
+		case SortPriceDesc:
+			whereSQL += fmt.Sprintf(" AND (%[1]s < ? OR (%[1]s = ? AND id < ?))", priceColumn)
+			args = append(args, c.Price, c.Price, c.Id)
+		case SortDistance:
+			whereSQL += " AND (distanceKm > ? OR (distanceKm = ? AND id > ?))"
+			args = append(args, c.Distance, c.Distance, c.Id)
+		case SortRating:
+			whereSQL += " AND (ratingAverage < ? OR (ratingAverage = ? AND (ratingCount < ? OR (ratingCount = ? AND id < ?))))"
+			args = append(args, c.Rating, c.Rating, c.Count, c.Count, c.Id)
+		}
+	}
+
+	// fetch one extra row to know whether another page follows
+	args = append(args, f.Limit+1)
+	rows, err := db.DB.Query(`
+		SELECT `+postColumns+", "+distanceColumn+`
+		FROM `+from+whereSQL+" ORDER BY "+orderBy+" LIMIT ?", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Post
+		if err := scanPost(rows, &p, &p.DistanceKm); err != nil {
+			return nil, err
+		}
+		page.Posts = append(page.Posts, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(page.Posts) > f.Limit {
+		page.Posts = page.Posts[:f.Limit]
+		last := page.Posts[f.Limit-1]
+		cursor := postCursor{Sort: f.Sort, Id: last.Id}
+		switch f.Sort {
+		case SortPriceAsc, SortPriceDesc:
+			cursor.Price = postPrice(last, f.PricePeriod)
+		case SortDistance:
+			cursor.Distance = *last.DistanceKm
+		case SortRating:
+			cursor.Rating, cursor.Count = last.RatingAverage, last.RatingCount
+		}
+		page.NextCursor = encodePostCursor(cursor)
+	}
+
+	if err := loadPostDetails(postRefs(page.Posts)...); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// bboxCondition matches posts inside a box, including boxes that cross the antimeridian
+func bboxCondition(b geo.BBox) (string, []interface{}) {
+	if b.MinLng > b.MaxLng {
+		return "latitude BETWEEN ? AND ? AND (longitude >= ? OR longitude <= ?)",
+			[]interface{}{b.MinLat, b.MaxLat, b.MinLng, b.MaxLng}
+	}
+	return "latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?",
+		[]interface{}{b.MinLat, b.MaxLat, b.MinLng, b.MaxLng}
+}
+
+func postPrice(p Post, period string) float64 {
+	switch period {
+	case "weekly":
+		return p.WeeklyPrice
+	case "monthly":
+		return p.MonthlyPrice
+	}
+	return p.DailyPrice
+}
+
+func encodePostCursor(c postCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodePostCursor(s string) (postCursor, error) {
+	var c postCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(b, &c)
+	return c, err
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike escapes LIKE wildcards so user input matches literally
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
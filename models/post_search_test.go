@@ -0,0 +1,72 @@
+package models
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"rentx/db"
+	"rentx/geo"
+	"slices"
+	"testing"
+)
+
+func TestSearchRatingPagesThroughTies(t *testing.T) {
+	ownerId := newTestUser(t)
+	ratings := []struct {
+		average float64
+		count   int
+	}{
+		{4.5, 2}, {0, 0}, {4.5, 3}, {4.5, 2}, {5, 1}, {4.5, 2}, {0, 0}, {4.5, 3}, {3, 2},
+	}
+	var posts []*Post
+	for _, r := range ratings {
+		p := newTestPost(t, ownerId)
+		if _, err := db.DB.Exec("UPDATE posts SET ratingAverage=?, ratingCount=? WHERE id=?", r.average, r.count, p.Id); err != nil {
+			t.Fatal(err)
+		}
+		p.RatingAverage, p.RatingCount = r.average, r.count
+		posts = append(posts, p)
+	}
+	// best rated first, then most rated, then newest
+	slices.SortFunc(posts, func(a, b *Post) int {
+		return cmp.Or(cmp.Compare(b.RatingAverage, a.RatingAverage), cmp.Compare(b.RatingCount, a.RatingCount),
+			cmp.Compare(b.Id, a.Id))
+	})
+	var want []int64
+	for _, p := range posts {
+		want = append(want, p.Id)
+	}
+
+	for _, limit := range []int{1, 2, 3, 4} {
+		var got []int64
+		f := PostFilter{OwnerId: ownerId, Sort: SortRating, Limit: limit}
+		for range len(ratings) + 1 {
+			page, err := SearchApprovedPosts(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range page.Posts {
+				got = append(got, p.Id)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			f.Cursor = page.NextCursor
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("limit %d: paged ids = %v, want %v", limit, got, want)
+		}
+	}
+}
+
+func TestSearchRejectsInvalidRadius(t *testing.T) {
+	near := &geo.Point{Lat: 23.8, Lng: 90.4}
+	for _, radius := range []float64{math.NaN(), math.Inf(1), -1, maxRadiusKm + 1} {
+		if _, err := SearchApprovedPosts(PostFilter{Near: near, RadiusKm: radius}); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("radiusKm %v: err = %v, want ErrInvalidFilter", radius, err)
+		}
+	}
+	if _, err := SearchApprovedPosts(PostFilter{Near: near, RadiusKm: maxRadiusKm}); err != nil {
+		t.Errorf("radiusKm %d: %v", maxRadiusKm, err)
+	}
+}
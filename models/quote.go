@@ -0,0 +1,163 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"rentx/db"
+	"rentx/utils"
+)
+
+// PriceLineItem is one rental unit of a quote, e.g. 2 × week at 50.00
+type PriceLineItem struct {
+	Unit      string  `json:"unit"` // "month" | "week" | "day"
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unitPrice"`
+	Amount    float64 `json:"amount"`
+}
+
+// Quote is the price of renting a post for an inclusive date range
+type Quote struct {
+	PostId    int64           `json:"postId"`
+	StartDate string          `json:"startDate"`
+	EndDate   string          `json:"endDate"`
+	Days      int             `json:"days"`
+	Total     float64         `json:"total"`
+	LineItems []PriceLineItem `json:"lineItems"`
+}
+
+// MaxRentalDays is the longest date range that can be quoted or booked
+const MaxRentalDays = 365
+
+// ErrNoPricing is returned when a post has no positive daily, weekly or monthly price
+var ErrNoPricing = errors.New("post has no rental prices set")
+
+// rentalUnit is a billable period; units are tried longest first so that
+// ties resolve to fewer, larger units
+type rentalUnit struct {
+	name  string
+	days  int
+	cents int64
+}
+
+// CalculatePrice returns the cheapest combination of month (30 days), week
+// (7 days) and day units covering the given number of days. A unit with a
+// zero or negative price is treated as not offered. A larger unit may cover
+// more days than needed when that is cheaper, e.g. 6 days billed as one week.
+func CalculatePrice(dailyPrice, weeklyPrice, monthlyPrice float64, days int) ([]PriceLineItem, float64, error) {
+	if days <= 0 {
+		return nil, 0, errors.New("rental must be at least one day")
+	}
+
+	var units []rentalUnit
+	for _, u := range []struct {
+		name  string
+		days  int
+		price float64
+	}{
+		{"month", 30, monthlyPrice},
+		{"week", 7, weeklyPrice},
+		{"day", 1, dailyPrice},
+	} {
+		if u.price > 0 {
+			units = append(units, rentalUnit{u.name, u.days, toCents(u.price)})
+		}
+	}
+	if len(units) == 0 {
+		return nil, 0, ErrNoPricing
+	}
+
+	// cost[i] is the cheapest price covering i days; choice[i] is the unit used last
+	cost := make([]int64, days+1)
+	choice := make([]int, days+1)
+	for i := 1; i <= days; i++ {
+		cost[i] = math.MaxInt64
+		for u, unit := range units {
+			candidate := cost[max(0, i-unit.days)] + unit.cents
+			if candidate < cost[i] {
+				cost[i] = candidate
+				choice[i] = u
+			}
+		}
+	}
+
+	counts := make([]int, len(units))
+	for i := days; i > 0; i = max(0, i-units[choice[i]].days) {
+		counts[choice[i]]++
+	}
+
+	items := []PriceLineItem{}
+	for u, unit := range units {
+		if counts[u] == 0 {
+			continue
+		}
+		items = append(items, PriceLineItem{
+			Unit:      unit.name,
+			Quantity:  counts[u],
+			UnitPrice: fromCents(unit.cents),
+			Amount:    fromCents(unit.cents * int64(counts[u])),
+		})
+	}
+
+	return items, fromCents(cost[days]), nil
+}
+
+// QuotePost prices an approved post for an inclusive date range
+func QuotePost(postId int64, startDate, endDate string) (*Quote, error) {
+	return quotePost(db.DB, postId, startDate, endDate)
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func quotePost(q queryer, postId int64, startDate, endDate string) (*Quote, error) {
+	start, end, err := utils.ParseDateRange(startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDates, err)
+	}
+	days := utils.DayCount(start, end)
+	if days > MaxRentalDays {
+		return nil, fmt.Errorf("%w: a rental cannot be longer than %d days", ErrInvalidDates, MaxRentalDays)
+	}
+
+	var status string
+	var daily, weekly, monthly float64
+	err = q.QueryRow(`
+		SELECT status, dailyPrice, weeklyPrice, monthlyPrice FROM posts WHERE id=?`, postId).
+		Scan(&status, &daily, &weekly, &monthly)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPostNotBookable
+		}
+		return nil, err
+	}
+	if status != "approved" {
+		return nil, ErrPostNotBookable
+	}
+
+	items, total, err := CalculatePrice(daily, weekly, monthly, days)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Quote{
+		PostId:    postId,
+		StartDate: start.Format(utils.DateLayout),
+		EndDate:   end.Format(utils.DateLayout),
+		Days:      days,
+		Total:     total,
+		LineItems: items,
+	}, nil
+}
+
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func fromCents(cents int64) float64 {
+	return float64(cents) / 100
+}
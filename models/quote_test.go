@@ -0,0 +1,39 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestQuotePostCountsDays(t *testing.T) {
+	post := newTestPost(t, newTestUser(t))
+
+	quote, err := QuotePost(post.Id, "2027-01-01", "2027-12-31")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Days != MaxRentalDays {
+		t.Errorf("Days = %d, want %d", quote.Days, MaxRentalDays)
+	}
+
+	quote, err = QuotePost(post.Id, "2027-03-27", "2027-03-29")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quote.Days != 3 {
+		t.Errorf("Days = %d, want 3", quote.Days)
+	}
+}
+
+func TestQuotePostRejectsLongRanges(t *testing.T) {
+	post := newTestPost(t, newTestUser(t))
+
+	for _, r := range [][2]string{
+		{"2027-01-01", "2028-01-01"},
+		{"2000-01-01", "2400-12-31"},
+	} {
+		if _, err := QuotePost(post.Id, r[0], r[1]); !errors.Is(err, ErrInvalidDates) {
+			t.Errorf("QuotePost(%s, %s) = %v, want ErrInvalidDates", r[0], r[1], err)
+		}
+	}
+}
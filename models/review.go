@@ -3,35 +3,176 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"rentx/db"
+	"rentx/utils"
 )
 
+// Review is a renter's review of a rental: 1-5 stars, optional 1-5 star
+// sub-ratings and a text. Reviews written before ratings have Rating 0 and
+// do not count towards averages; those written before reviews were tied to
+// orders have no OrderId.
 type Review struct {
-	Id       int64  `json:"id"`
-	UserId   int64  `json:"userId" binding:"required"`
-	PostId   int64  `json:"postId" binding:"required"`
-	Review   string `json:"review" binding:"required"`
-	DateTime string `json:"dateTime"`
+	Id            int64  `json:"id"`
+	UserId        int64  `json:"userId"` // the renter, taken from the auth token
+	PostId        int64  `json:"postId"` // taken from the order
+	OrderId       *int64 `json:"orderId" binding:"required"`
+	Rating        int    `json:"rating" binding:"required"`
+	Accuracy      *int   `json:"accuracy"`      // the listing matched the item
+	Communication *int   `json:"communication"` // with the owner
+	Condition     *int   `json:"condition"`     // of the item
+	Review        string `json:"review" binding:"required"`
+	DateTime      string `json:"dateTime"`
 }
 
-// Save inserts a new review
+// RatingSummary aggregates the rated reviews of a post or an owner. Sub-rating
+// averages are nil when no review gave that sub-rating.
+type RatingSummary struct {
+	Average       float64     `json:"average"`
+	Count         int         `json:"count"`
+	Stars         map[int]int `json:"stars"` // number of reviews per star rating
+	Accuracy      *float64    `json:"accuracy"`
+	Communication *float64    `json:"communication"`
+	Condition     *float64    `json:"condition"`
+}
+
+// ReviewWindowDays is how long after the item is returned the renter may review the rental
+const ReviewWindowDays = 14
+
+// Review errors
+var (
+	// ErrInvalidReview is returned for ratings outside 1-5 stars
+	ErrInvalidReview = errors.New("invalid review")
+	// ErrReviewNotAllowed is returned when the order cannot be reviewed by
+	// the user, or not yet or no longer
+	ErrReviewNotAllowed = errors.New("review not allowed")
+	// ErrReviewExists is returned when the order already has a review
+	ErrReviewExists = errors.New("this order has already been reviewed")
+)
+
+// reviewColumns are the columns scanned by scanReview
+const reviewColumns = `id, userId, postId, orderId, rating, accuracyRating, communicationRating, conditionRating, review, dateTime`
+
+func scanReview(row rowScanner, r *Review) error {
+	return row.Scan(&r.Id, &r.UserId, &r.PostId, &r.OrderId, &r.Rating, &r.Accuracy, &r.Communication, &r.Condition,
+		&r.Review, &r.DateTime)
+}
+
+// validate checks the star ratings
+func (r *Review) validate() error {
+	if r.Rating < 1 || r.Rating > 5 {
+		return fmt.Errorf("%w: rating must be 1 to 5 stars", ErrInvalidReview)
+	}
+	subRatings := []struct {
+		name  string
+		stars *int
+	}{{"accuracy", r.Accuracy}, {"communication", r.Communication}, {"condition", r.Condition}}
+	for _, sub := range subRatings {
+		if sub.stars != nil && (*sub.stars < 1 || *sub.stars > 5) {
+			return fmt.Errorf("%w: %s must be 1 to 5 stars", ErrInvalidReview, sub.name)
+		}
+	}
+	return nil
+}
+
+// Save inserts the review of an order by r.UserId. Only the renter may
+// review, once per order, after the item came back (returned or completed)
+// and the rental ended, until ReviewWindowDays later (see checkReviewable).
+// The post's cached rating follows (see createRatingAggregates).
 func (r *Review) Save() error {
-	res, err := db.DB.Exec(
-		"INSERT INTO reviews (userId, postId, review) VALUES (?, ?, ?)",
-		r.UserId, r.PostId, r.Review,
+	if err := r.validate(); err != nil {
+		return err
+	}
+	if r.OrderId == nil {
+		return fmt.Errorf("%w: orderId is required", ErrInvalidReview)
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var renterId, postId int64
+	var status, endDate string
+	var returnedDate sql.NullString
+	var reviewed bool
+	err = tx.QueryRow(`
+		SELECT userId, postId, status, endDate,
+			(SELECT date(MAX(dateTime)) FROM order_status_history WHERE orderId = orders.id AND toStatus = ?),
+			EXISTS (SELECT 1 FROM reviews WHERE orderId = orders.id)
+		FROM orders WHERE id=?`, OrderReturned, *r.OrderId).Scan(&renterId, &postId, &status, &endDate, &returnedDate, &reviewed)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOrderNotFound
+		}
+		return err
+	}
+	if err := checkReviewable(renterId, r.UserId, status, endDate, returnedDate.String, reviewed); err != nil {
+		return err
+	}
+
+	r.PostId = postId
+	res, err := tx.Exec(`
+		INSERT INTO reviews (userId, postId, orderId, rating, accuracyRating, communicationRating, conditionRating, review)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.UserId, r.PostId, r.OrderId, r.Rating, r.Accuracy, r.Communication, r.Condition, r.Review,
 	)
 	if err != nil {
 		return err
 	}
 	r.Id, _ = res.LastInsertId()
+	return tx.Commit()
+}
+
+// checkReviewable applies the review rules to an order. The review window
+// opens the day after the end date and closes ReviewWindowDays after the
+// item was returned (returnedDate, from the status history), or after the
+// end date when the item came back early. Orders returned before the status
+// history was kept have no returnedDate and use the end date.
+func checkReviewable(renterId, userId int64, status, endDate, returnedDate string, reviewed bool) error {
+	if renterId != userId {
+		return fmt.Errorf("%w: only the renter of the order can review it", ErrReviewNotAllowed)
+	}
+	if status != OrderReturned && status != OrderCompleted {
+		return fmt.Errorf("%w: the rental can be reviewed once the item is returned", ErrReviewNotAllowed)
+	}
+	if reviewed {
+		return ErrReviewExists
+	}
+	end, err := utils.ParseDate(endDate)
+	if err != nil {
+		return err
+	}
+	today := utils.Today()
+	if !today.After(end) {
+		return fmt.Errorf("%w: the rental can be reviewed once it has ended", ErrReviewNotAllowed)
+	}
+	windowStart := end
+	if returnedDate != "" {
+		returned, err := utils.ParseDate(returnedDate)
+		if err != nil {
+			return err
+		}
+		if returned.After(end) {
+			windowStart = returned
+		}
+	}
+	if today.After(windowStart.AddDate(0, 0, ReviewWindowDays)) {
+		return fmt.Errorf("%w: rentals can be reviewed up to %d days after the item is returned", ErrReviewNotAllowed, ReviewWindowDays)
+	}
 	return nil
 }
 
 // Update modifies a review (only by the owner)
 func (r *Review) Update(userId int64) error {
-	res, err := db.DB.Exec(
-		"UPDATE reviews SET review=? WHERE id=? AND userId=?",
-		r.Review, r.Id, userId,
+	if err := r.validate(); err != nil {
+		return err
+	}
+	res, err := db.DB.Exec(`
+		UPDATE reviews SET rating=?, accuracyRating=?, communicationRating=?, conditionRating=?, review=?
+		WHERE id=? AND userId=?`,
+		r.Rating, r.Accuracy, r.Communication, r.Condition, r.Review, r.Id, userId,
 	)
 	if err != nil {
 		return err
@@ -60,9 +201,9 @@ func (r *Review) Delete(userId int64) error {
 
 // GetReviewByID fetches a single review
 func GetReviewByID(id int64) (*Review, error) {
-	row := db.DB.QueryRow("SELECT id, userId, postId, review, dateTime FROM reviews WHERE id=?", id)
+	row := db.DB.QueryRow("SELECT "+reviewColumns+" FROM reviews WHERE id=?", id)
 	var r Review
-	if err := row.Scan(&r.Id, &r.UserId, &r.PostId, &r.Review, &r.DateTime); err != nil {
+	if err := scanReview(row, &r); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errors.New("review not found")
 		}
@@ -73,7 +214,7 @@ func GetReviewByID(id int64) (*Review, error) {
 
 // ListReviews fetches all reviews for a specific post
 func ListReviews(postId int64) ([]Review, error) {
-	rows, err := db.DB.Query("SELECT id, userId, postId, review, dateTime FROM reviews WHERE postId=?", postId)
+	rows, err := db.DB.Query("SELECT "+reviewColumns+" FROM reviews WHERE postId=?", postId)
 	if err != nil {
 		return nil, err
 	}
@@ -82,10 +223,53 @@ func ListReviews(postId int64) ([]Review, error) {
 	var reviews []Review
 	for rows.Next() {
 		var r Review
-		if err := rows.Scan(&r.Id, &r.UserId, &r.PostId, &r.Review, &r.DateTime); err != nil {
+		if err := scanReview(rows, &r); err != nil {
 			return nil, err
 		}
 		reviews = append(reviews, r)
 	}
 	return reviews, nil
 }
+
+// GetPostRatingSummary aggregates the rated reviews of a post
+func GetPostRatingSummary(postId int64) (*RatingSummary, error) {
+	if _, err := GetPostStatus(postId); err != nil {
+		return nil, err
+	}
+	return ratingSummary("reviews.postId = ?", postId)
+}
+
+// GetOwnerRatingSummary aggregates the rated reviews of every post of an
+// owner, each review counting once
+func GetOwnerRatingSummary(ownerId int64) (*RatingSummary, error) {
+	if _, err := GetUserByID(ownerId); err != nil {
+		return nil, err
+	}
+	return ratingSummary("reviews.postId IN (SELECT id FROM posts WHERE userId = ?)", ownerId)
+}
+
+func ratingSummary(where string, args ...interface{}) (*RatingSummary, error) {
+	s := &RatingSummary{Stars: map[int]int{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}}
+	err := db.DB.QueryRow(`
+		SELECT COUNT(*), COALESCE(ROUND(AVG(rating), 2), 0),
+			ROUND(AVG(accuracyRating), 2), ROUND(AVG(communicationRating), 2), ROUND(AVG(conditionRating), 2)
+		FROM reviews WHERE rating > 0 AND `+where, args...).
+		Scan(&s.Count, &s.Average, &s.Accuracy, &s.Communication, &s.Condition)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.DB.Query("SELECT rating, COUNT(*) FROM reviews WHERE rating > 0 AND "+where+" GROUP BY rating", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var stars, count int
+		if err := rows.Scan(&stars, &count); err != nil {
+			return nil, err
+		}
+		s.Stars[stars] = count
+	}
+	return s, rows.Err()
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"errors"
+	"rentx/db"
+	"rentx/utils"
+	"testing"
+)
+
+// newReturnedOrder inserts an order of post by renter that ended endedDaysAgo
+// and was returned returnedDaysAgo (negative for the future)
+func newReturnedOrder(t *testing.T, renterId, postId int64, endedDaysAgo, returnedDaysAgo int) int64 {
+	t.Helper()
+	daysAgo := func(n int) string { return utils.Today().AddDate(0, 0, -n).Format(utils.DateLayout) }
+
+	res, err := db.DB.Exec(`
+		INSERT INTO orders (userId, postId, startDate, endDate, status) VALUES (?, ?, ?, ?, ?)`,
+		renterId, postId, daysAgo(endedDaysAgo+3), daysAgo(endedDaysAgo), OrderReturned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orderId, _ := res.LastInsertId()
+	_, err = db.DB.Exec(`
+		INSERT INTO order_status_history (orderId, fromStatus, toStatus, actorId, dateTime) VALUES (?, ?, ?, ?, ?)`,
+		orderId, OrderActive, OrderReturned, renterId, daysAgo(returnedDaysAgo)+" 18:30:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return orderId
+}
+
+func TestReviewWindow(t *testing.T) {
+	renterId := newTestUser(t)
+	post := newTestPost(t, newTestUser(t))
+
+	for _, c := range []struct {
+		name                          string
+		endedDaysAgo, returnedDaysAgo int
+		want                          error
+	}{
+		{"returned yesterday", 1, 1, nil},
+		{"returned late, window counts from the return", 30, ReviewWindowDays, nil},
+		{"window closed after the return", 30, ReviewWindowDays + 1, ErrReviewNotAllowed},
+		{"returned early, rental not over", -2, 1, ErrReviewNotAllowed},
+		{"returned early, ends today", 0, 1, ErrReviewNotAllowed},
+		{"returned early, window counts from the end", ReviewWindowDays, 20, nil},
+		{"returned early, window closed after the end", ReviewWindowDays + 1, 20, ErrReviewNotAllowed},
+	} {
+		orderId := newReturnedOrder(t, renterId, post.Id, c.endedDaysAgo, c.returnedDaysAgo)
+		r := &Review{UserId: renterId, OrderId: &orderId, Rating: 5, Review: "Great"}
+		if err := r.Save(); !errors.Is(err, c.want) {
+			t.Errorf("%s: Save() = %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestReviewOncePerOrderByRenter(t *testing.T) {
+	renterId := newTestUser(t)
+	post := newTestPost(t, newTestUser(t))
+	orderId := newReturnedOrder(t, renterId, post.Id, 1, 1)
+
+	other := &Review{UserId: post.UserId, OrderId: &orderId, Rating: 4, Review: "Mine"}
+	if err := other.Save(); !errors.Is(err, ErrReviewNotAllowed) {
+		t.Errorf("review by the owner: Save() = %v, want ErrReviewNotAllowed", err)
+	}
+
+	first := &Review{UserId: renterId, OrderId: &orderId, Rating: 4, Review: "Good"}
+	if err := first.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if first.PostId != post.Id {
+		t.Errorf("PostId = %d, want %d", first.PostId, post.Id)
+	}
+	second := &Review{UserId: renterId, OrderId: &orderId, Rating: 2, Review: "Again"}
+	if err := second.Save(); !errors.Is(err, ErrReviewExists) {
+		t.Errorf("second review: Save() = %v, want ErrReviewExists", err)
+	}
+}
+
+func TestPostRatingFollowsReviews(t *testing.T) {
+	post := newTestPost(t, newTestUser(t))
+	rating := func() (float64, int) {
+		t.Helper()
+		p, err := getPost(post.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p.RatingAverage, p.RatingCount
+	}
+	review := func(stars int) *Review {
+		t.Helper()
+		renterId := newTestUser(t)
+		orderId := newReturnedOrder(t, renterId, post.Id, 1, 1)
+		r := &Review{UserId: renterId, OrderId: &orderId, Rating: stars, Review: "Fine"}
+		if err := r.Save(); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	first, second := review(5), review(2)
+	if avg, count := rating(); avg != 3.5 || count != 2 {
+		t.Errorf("after two reviews: rating = %v from %d, want 3.5 from 2", avg, count)
+	}
+	third := review(4)
+	if avg, count := rating(); avg != 3.67 || count != 3 {
+		t.Errorf("after three reviews: rating = %v from %d, want 3.67 from 3", avg, count)
+	}
+
+	second.Rating = 3
+	if err := second.Update(second.UserId); err != nil {
+		t.Fatal(err)
+	}
+	if avg, count := rating(); avg != 4 || count != 3 {
+		t.Errorf("after an update: rating = %v from %d, want 4 from 3", avg, count)
+	}
+
+	// reviews from before ratings existed do not count
+	if _, err := db.DB.Exec("UPDATE reviews SET rating=0 WHERE id=?", third.Id); err != nil {
+		t.Fatal(err)
+	}
+	if avg, count := rating(); avg != 4 || count != 2 {
+		t.Errorf("with an unrated review: rating = %v from %d, want 4 from 2", avg, count)
+	}
+
+	for _, r := range []*Review{first, second, third} {
+		if err := r.Delete(r.UserId); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if avg, count := rating(); avg != 0 || count != 0 {
+		t.Errorf("after deleting every review: rating = %v from %d, want 0 from 0", avg, count)
+	}
+}
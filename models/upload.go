@@ -0,0 +1,294 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"rentx/db"
+	"rentx/filestore"
+	"rentx/utils"
+	"strings"
+	"time"
+)
+
+// FileStore holds uploaded files; replaceable at startup
+var FileStore filestore.Store = filestore.NewLocal("storage", "/storage")
+
+// uploadKeyPrefix is the file store folder of post images
+const uploadKeyPrefix = "posts/"
+
+// Upload is a stored image with its resized variants. Url is the full-size
+// image (re-encoded without metadata) that posts reference in imageUrls.
+// Identical files are stored once and shared by everyone who uploads them.
+type Upload struct {
+	Id        int64  `json:"id"`
+	Url       string `json:"url"`
+	ThumbUrl  string `json:"thumbUrl"`
+	MediumUrl string `json:"mediumUrl"`
+	LargeUrl  string `json:"largeUrl"`
+	Mime      string `json:"mime"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Reused    bool   `json:"reused"` // the caller had uploaded the same file before
+	DateTime  string `json:"dateTime"`
+}
+
+var (
+	// ErrUnreadableImage is returned for uploads that pass inspection but fail to decode
+	ErrUnreadableImage = errors.New("unreadable image")
+	// ErrImageNotOwned is returned when a post references an image that is
+	// neither one of the caller's uploads nor already on the post
+	ErrImageNotOwned = errors.New("image is not one of your uploads")
+)
+
+// StoreImageUpload records an inspected image as uploaded by userId. A file
+// whose content was stored before is reused; otherwise it is re-encoded into
+// its variants and written to the file store, the full-size image under
+// posts/<random><ext> and each variant under posts/<random>_<variant><ext>.
+func StoreImageUpload(userId int64, data []byte, info utils.ImageInfo) (*Upload, error) {
+	sum := sha256.Sum256(data)
+	contentHash := hex.EncodeToString(sum[:])
+
+	if u, err := claimExistingUpload(userId, contentHash); err != nil || u != nil {
+		return u, err
+	}
+
+	images, err := utils.ProcessImage(data, info)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreadableImage, err)
+	}
+
+	base, err := newUploadName()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	u := &Upload{}
+	var storageKey string
+	var written []string
+	for _, img := range images {
+		key := uploadKeyPrefix + base + "_" + img.Variant + img.Ext
+		if img.Variant == utils.OriginalVariant {
+			key = uploadKeyPrefix + base + img.Ext
+			storageKey = key
+			u.Mime = img.MIME
+			u.Width, u.Height = img.Width, img.Height
+		}
+		if err := FileStore.Put(ctx, key, img.Data, img.MIME); err != nil {
+			deleteStoredFiles(written)
+			return nil, err
+		}
+		written = append(written, key)
+
+		switch img.Variant {
+		case utils.OriginalVariant:
+			u.Url = FileStore.URL(key)
+		case "thumb":
+			u.ThumbUrl = FileStore.URL(key)
+		case "medium":
+			u.MediumUrl = FileStore.URL(key)
+		case "large":
+			u.LargeUrl = FileStore.URL(key)
+		}
+	}
+
+	tx, err := db.DB.Begin()
+	if err != nil {
+		deleteStoredFiles(written)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// the same file may have been stored by a concurrent upload meanwhile
+	existing, err := claimUpload(tx, userId, contentHash)
+	if err == nil && existing == nil {
+		err = insertUpload(tx, userId, contentHash, storageKey, u)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		deleteStoredFiles(written)
+		return nil, err
+	}
+	if existing != nil {
+		deleteStoredFiles(written)
+		return existing, nil
+	}
+	return u, nil
+}
+
+// uploadColumns are the columns scanned by scanUpload
+const uploadColumns = `id, url, thumbUrl, mediumUrl, largeUrl, mime, width, height, dateTime`
+
+func scanUpload(row rowScanner, u *Upload) error {
+	return row.Scan(&u.Id, &u.Url, &u.ThumbUrl, &u.MediumUrl, &u.LargeUrl, &u.Mime, &u.Width, &u.Height, &u.DateTime)
+}
+
+// claimExistingUpload returns the stored upload with the given content hash,
+// now also owned by userId, or nil when the content is new
+func claimExistingUpload(userId int64, contentHash string) (*Upload, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	u, err := claimUpload(tx, userId, contentHash)
+	if err != nil || u == nil {
+		return nil, err
+	}
+	return u, tx.Commit()
+}
+
+func claimUpload(tx *sql.Tx, userId int64, contentHash string) (*Upload, error) {
+	u := &Upload{}
+	err := scanUpload(tx.QueryRow("SELECT "+uploadColumns+" FROM uploads WHERE contentHash=?", contentHash), u)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Reused only tells callers about their own uploads; whether someone
+	// else stored the file is not theirs to know
+	err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM upload_owners WHERE uploadId=? AND userId=?)", u.Id, userId).
+		Scan(&u.Reused)
+	if err != nil {
+		return nil, err
+	}
+	// re-uploading restarts the time the owner has to attach the file
+	_, err = tx.Exec(`
+		INSERT INTO upload_owners (uploadId, userId) VALUES (?, ?)
+		ON CONFLICT (uploadId, userId) DO UPDATE SET dateTime=CURRENT_TIMESTAMP`, u.Id, userId)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+func insertUpload(tx *sql.Tx, userId int64, contentHash, storageKey string, u *Upload) error {
+	res, err := tx.Exec(`
+		INSERT INTO uploads (url, thumbUrl, mediumUrl, largeUrl, mime, width, height, storageKey, contentHash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		u.Url, u.ThumbUrl, u.MediumUrl, u.LargeUrl, u.Mime, u.Width, u.Height, storageKey, contentHash)
+	if err != nil {
+		return err
+	}
+	u.Id, _ = res.LastInsertId()
+	_, err = tx.Exec("INSERT INTO upload_owners (uploadId, userId) VALUES (?, ?)", u.Id, userId)
+	return err
+}
+
+// checkImageOwnership makes sure every image URL given for a post is one of
+// userId's uploads or already on the post (postId 0 for a new post), so
+// users cannot attach other people's images
+func checkImageOwnership(tx *sql.Tx, postId, userId int64, urls []string) error {
+	for _, url := range nonEmpty(urls) {
+		var allowed bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (
+					SELECT 1 FROM uploads JOIN upload_owners ON upload_owners.uploadId = uploads.id
+					WHERE uploads.url=? AND upload_owners.userId=?)
+				OR EXISTS (SELECT 1 FROM post_images WHERE postId=? AND imageUrl=?)`,
+			url, userId, postId, url).Scan(&allowed)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fmt.Errorf("%w: %s", ErrImageNotOwned, url)
+		}
+	}
+	return nil
+}
+
+// unusedUpload matches uploads no post references that nobody has uploaded
+// within the TTL given as a datetime('now', ?) modifier
+const unusedUpload = `uploads.refCount <= 0
+	AND uploads.dateTime < datetime('now', ?)
+	AND NOT EXISTS (SELECT 1 FROM upload_owners
+		WHERE upload_owners.uploadId = uploads.id AND upload_owners.dateTime >= datetime('now', ?))`
+
+// SweepOrphanedUploads deletes uploads that no post uses and nobody uploaded
+// within ttl: images never attached to a post and images whose last post was
+// deleted or edited. Files shared by several posts stay until the last one
+// lets go. It returns how many uploads were removed.
+func SweepOrphanedUploads(ttl time.Duration) (int, error) {
+	age := fmt.Sprintf("-%d seconds", int64(ttl.Seconds()))
+	rows, err := db.DB.Query("SELECT id, storageKey FROM uploads WHERE "+unusedUpload, age, age)
+	if err != nil {
+		return 0, err
+	}
+
+	type orphan struct {
+		id         int64
+		storageKey string
+	}
+	var orphans []orphan
+	for rows.Next() {
+		var o orphan
+		if err := rows.Scan(&o.id, &o.storageKey); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		orphans = append(orphans, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, o := range orphans {
+		// re-checked here in case the image was used or uploaded again since the query
+		res, err := db.DB.Exec("DELETE FROM uploads WHERE id=? AND "+unusedUpload, o.id, age, age)
+		if err != nil {
+			return removed, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue
+		}
+		deleteStoredFiles(uploadFileKeys(o.storageKey))
+		removed++
+	}
+	return removed, nil
+}
+
+// uploadFileKeys lists the file store keys of an upload from the key of its
+// full-size image
+func uploadFileKeys(storageKey string) []string {
+	if storageKey == "" {
+		return nil
+	}
+	ext := path.Ext(storageKey)
+	base := strings.TrimSuffix(storageKey, ext)
+	keys := []string{storageKey}
+	for _, size := range utils.ImageVariantSizes {
+		keys = append(keys, base+"_"+size.Name+ext)
+	}
+	return keys
+}
+
+// deleteStoredFiles removes files from the file store, logging failures
+func deleteStoredFiles(keys []string) {
+	for _, key := range keys {
+		if err := FileStore.Delete(context.Background(), key); err != nil {
+			fmt.Printf("⚠️  Deleting stored file %s failed: %v\n", key, err)
+		}
+	}
+}
+
+// newUploadName returns a random file name, unique across API instances
+func newUploadName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
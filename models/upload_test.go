@@ -0,0 +1,259 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"rentx/db"
+	"rentx/utils"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore is a file store in memory that remembers deleted keys
+type memStore struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	deleted []string
+}
+
+func (m *memStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[key] = data
+	return nil
+}
+
+func (m *memStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, key)
+	m.deleted = append(m.deleted, key)
+	return nil
+}
+
+func (m *memStore) URL(key string) string {
+	return "/storage/" + key
+}
+
+// useMemStore replaces FileStore for the rest of the test
+func useMemStore(t *testing.T) *memStore {
+	t.Helper()
+	store := &memStore{files: map[string][]byte{}}
+	previous := FileStore
+	FileStore = store
+	t.Cleanup(func() { FileStore = previous })
+	return store
+}
+
+// testImage returns a small PNG; images with different seeds differ
+func testImage(t *testing.T, seed int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = byte(seed + i)
+	}
+	img.Set(0, 0, color.NRGBA{A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func storeUpload(t *testing.T, userId int64, data []byte) *Upload {
+	t.Helper()
+	info, err := utils.InspectImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := StoreImageUpload(userId, data, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestStoreImageUploadReusedPerCaller(t *testing.T) {
+	store := useMemStore(t)
+	alice, bob := newTestUser(t), newTestUser(t)
+	data := testImage(t, 1)
+
+	first := storeUpload(t, alice, data)
+	if first.Reused {
+		t.Error("first upload reported as reused")
+	}
+	stored := len(store.files)
+
+	again := storeUpload(t, alice, data)
+	if !again.Reused || again.Url != first.Url {
+		t.Errorf("upload again by the same user: reused %v, url %s; want true, %s", again.Reused, again.Url, first.Url)
+	}
+	other := storeUpload(t, bob, data)
+	if other.Reused || other.Url != first.Url {
+		t.Errorf("upload by another user: reused %v, url %s; want false, %s", other.Reused, other.Url, first.Url)
+	}
+	if len(store.files) != stored {
+		t.Errorf("identical uploads stored %d files, want %d", len(store.files), stored)
+	}
+	found := false
+	for key := range store.files {
+		found = found || store.URL(key) == first.Url
+	}
+	if !found {
+		t.Errorf("stored files do not include %s", first.Url)
+	}
+}
+
+// ageUpload makes an upload and its owners look as if last uploaded ago
+// (a datetime modifier such as "-2 hours")
+func ageUpload(t *testing.T, u *Upload, ago string) {
+	t.Helper()
+	if _, err := db.DB.Exec("UPDATE uploads SET dateTime=datetime('now', ?) WHERE id=?", ago, u.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.DB.Exec("UPDATE upload_owners SET dateTime=datetime('now', ?) WHERE uploadId=?", ago, u.Id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func uploadExists(t *testing.T, u *Upload) bool {
+	t.Helper()
+	var exists bool
+	if err := db.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM uploads WHERE id=?)", u.Id).Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+	return exists
+}
+
+func sweep(t *testing.T) {
+	t.Helper()
+	if _, err := SweepOrphanedUploads(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSweepKeepsSharedUploads(t *testing.T) {
+	useMemStore(t)
+	alice, bob := newTestUser(t), newTestUser(t)
+	data := testImage(t, 2)
+	u := storeUpload(t, alice, data)
+	storeUpload(t, bob, data)
+	first := newTestPost(t, alice, u.Url)
+	second := newTestPost(t, bob, u.Url)
+	ageUpload(t, u, "-2 hours")
+
+	if err := first.Delete(alice, "user"); err != nil {
+		t.Fatal(err)
+	}
+	sweep(t)
+	if !uploadExists(t, u) {
+		t.Fatal("upload still used by a post was swept")
+	}
+
+	if _, err := BulkModeratePosts(BulkDelete, []int64{second.Id}, "", alice, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	sweep(t)
+	if uploadExists(t, u) {
+		t.Error("upload of deleted posts was kept")
+	}
+}
+
+func TestSweepKeepsUploadsWithinTTL(t *testing.T) {
+	useMemStore(t)
+	alice, bob := newTestUser(t), newTestUser(t)
+	data := testImage(t, 3)
+	fresh := storeUpload(t, alice, testImage(t, 4))
+	u := storeUpload(t, alice, data)
+	ageUpload(t, u, "-2 hours")
+
+	// uploading the file again, even by someone else, restarts the TTL
+	storeUpload(t, bob, data)
+	sweep(t)
+	if !uploadExists(t, u) {
+		t.Error("upload uploaded again within the TTL was swept")
+	}
+	if !uploadExists(t, fresh) {
+		t.Error("upload within the TTL was swept")
+	}
+}
+
+func TestSweepDeletesOrphanFiles(t *testing.T) {
+	store := useMemStore(t)
+	owner := newTestUser(t)
+	u := storeUpload(t, owner, testImage(t, 5))
+	post := newTestPost(t, owner, u.Url)
+	if err := post.Delete(owner, "user"); err != nil {
+		t.Fatal(err)
+	}
+	ageUpload(t, u, "-2 hours")
+
+	var storageKey string
+	if err := db.DB.QueryRow("SELECT storageKey FROM uploads WHERE id=?", u.Id).Scan(&storageKey); err != nil {
+		t.Fatal(err)
+	}
+	keys := uploadFileKeys(storageKey)
+	if len(keys) != len(utils.ImageVariantSizes)+1 {
+		t.Fatalf("file keys = %v", keys)
+	}
+	for _, key := range keys {
+		if _, ok := store.files[key]; !ok {
+			t.Fatalf("%s was not stored", key)
+		}
+	}
+
+	sweep(t)
+	if uploadExists(t, u) {
+		t.Fatal("orphaned upload was kept")
+	}
+	for _, key := range keys {
+		if _, ok := store.files[key]; ok || !slices.Contains(store.deleted, key) {
+			t.Errorf("%s was not deleted", key)
+		}
+	}
+	var owners int
+	if err := db.DB.QueryRow("SELECT COUNT(*) FROM upload_owners WHERE uploadId=?", u.Id).Scan(&owners); err != nil {
+		t.Fatal(err)
+	}
+	if owners != 0 {
+		t.Errorf("%d owners left for a swept upload", owners)
+	}
+}
+
+func TestCheckImageOwnership(t *testing.T) {
+	alice, bob, admin := newTestUser(t), newTestUser(t), newTestUser(t)
+	aliceUrl, bobUrl := newTestUpload(t, alice), newTestUpload(t, bob)
+	post := newTestPost(t, alice, aliceUrl)
+
+	other := *post
+	other.Id, other.UserId, other.ImageUrls = 0, bob, []string{aliceUrl}
+	if err := other.Save("user"); !errors.Is(err, ErrImageNotOwned) {
+		t.Errorf("new post with another user's upload: err = %v, want ErrImageNotOwned", err)
+	}
+
+	edit := *post
+	edit.ImageUrls = []string{aliceUrl, bobUrl}
+	if err := edit.Update(alice, "user"); !errors.Is(err, ErrImageNotOwned) {
+		t.Errorf("adding another user's upload: err = %v, want ErrImageNotOwned", err)
+	}
+	stored, err := getPost(post.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := imageUrls(stored); !slices.Equal(got, []string{aliceUrl}) {
+		t.Errorf("images after the refused update = %v, want [%s]", got, aliceUrl)
+	}
+
+	// images already on the post may stay, whoever edits it
+	edit.ImageUrls = []string{aliceUrl}
+	edit.Description = "Edited by an admin"
+	if err := edit.Update(admin, "admin"); err != nil {
+		t.Errorf("keeping the post's images: %v", err)
+	}
+}
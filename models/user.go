@@ -53,13 +53,16 @@ func (u *User) LoadByPhone() error {
 	)
 }
 
+// ErrUserNotFound is returned when a user does not exist
+var ErrUserNotFound = errors.New("user not found")
+
 // GetUserByID fetches a user by ID
 func GetUserByID(id int64) (*User, error) {
 	row := db.DB.QueryRow("SELECT id, name, email, phone, password, image, role, dateTime FROM users WHERE id=?", id)
 	var u User
 	if err := row.Scan(&u.Id, &u.Name, &u.Email, &u.Phone, &u.Password, &u.Image, &u.Role, &u.DateTime); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errors.New("user not found")
+			return nil, ErrUserNotFound
 		}
 		return nil, err
 	}
@@ -0,0 +1,245 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"rentx/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ----------------- LIST BLOCKED RANGES -----------------
+func listBlackouts(c *gin.Context) {
+	postId, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+
+	blackouts, err := models.ListBlackouts(postId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch blocked dates"})
+		return
+	}
+	c.JSON(http.StatusOK, blackouts)
+}
+
+// ----------------- ADD BLOCKED RANGE -----------------
+func createBlackout(c *gin.Context) {
+	postId, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+
+	var b models.Blackout
+	if err := c.ShouldBindJSON(&b); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input", "error": err.Error()})
+		return
+	}
+	b.PostId = postId
+
+	if err := b.Save(); err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidDates):
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		case errors.Is(err, models.ErrBookingConflict):
+			c.JSON(http.StatusConflict, gin.H{"message": "dates overlap an existing booking"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not block dates", "error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, b)
+}
+
+// ----------------- REMOVE BLOCKED RANGE -----------------
+func deleteBlackout(c *gin.Context) {
+	postId, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+
+	blackoutId, err := strconv.ParseInt(c.Param("blackoutId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid blocked range ID"})
+		return
+	}
+
+	b := models.Blackout{Id: blackoutId, PostId: postId}
+	if err := b.Delete(); err != nil {
+		if errors.Is(err, models.ErrBlackoutNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not remove blocked dates"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Blocked dates removed"})
+}
+
+// ----------------- AVAILABILITY CALENDAR -----------------
+func getPostCalendar(c *gin.Context) {
+	postId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid post ID"})
+		return
+	}
+
+	cal, err := models.GetPostCalendar(postId, c.Query("month"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidDates):
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		case errors.Is(err, models.ErrPostNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch calendar"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, cal)
+}
+
+// authorizePostManagement parses the :id post param and aborts with
+// 400/404/403 unless the caller owns the post or is an admin
+func authorizePostManagement(c *gin.Context) (int64, bool) {
+	postId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid post ID"})
+		return 0, false
+	}
+
+	err = models.CanManagePost(postId, c.GetInt64("userId"), c.GetString("role"))
+	switch {
+	case err == nil:
+		return postId, true
+	case errors.Is(err, models.ErrPostNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, models.ErrUnauthorized):
+		c.JSON(http.StatusForbidden, gin.H{"message": "not allowed"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch post"})
+	}
+	return 0, false
+}
+
+// ----------------- ICAL FEED (public, by secret token) -----------------
+func getICalFeed(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("file"), ".ics")
+
+	body, err := models.ExportICalByToken(token)
+	if err != nil {
+		if errors.Is(err, models.ErrPostNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "Calendar not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not build calendar"})
+		return
+	}
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", body)
+}
+
+// ----------------- ICAL SETTINGS -----------------
+func getICalSettings(c *gin.Context) {
+	postId, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+	respondICalSettings(c, postId)
+}
+
+func setICalImportURL(c *gin.Context) {
+	postId, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Url string `json:"url"` // empty to stop importing
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input", "error": err.Error()})
+		return
+	}
+
+	if err := models.SetICalImportURL(postId, strings.TrimSpace(body.Url)); err != nil {
+		if errors.Is(err, models.ErrInvalidICal) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not save feed URL", "error": err.Error()})
+		return
+	}
+
+	// first sync right away; failures are reported in lastSyncError
+	if body.Url != "" {
+		_ = models.SyncICalImport(postId)
+	}
+	respondICalSettings(c, postId)
+}
+
+func syncICalImport(c *gin.Context) {
+	postId, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+
+	if err := models.SyncICalImport(postId); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"message": "Could not sync calendar", "error": err.Error()})
+		return
+	}
+	respondICalSettings(c, postId)
+}
+
+func uploadICalFile(c *gin.Context) {
+	postId, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+
+	fileHeader, err := c.FormFile("file") // expecting input name="file"
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "No file uploaded"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Could not read file"})
+		return
+	}
+	defer file.Close()
+
+	imported, err := models.ImportICalFile(postId, file)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidICal) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not import calendar", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Calendar imported", "imported": imported})
+}
+
+func respondICalSettings(c *gin.Context, postId int64) {
+	feed, err := models.GetCalendarFeed(postId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch calendar settings"})
+		return
+	}
+	feed.FeedUrl = requestBaseURL(c) + feed.FeedPath
+	c.JSON(http.StatusOK, feed)
+}
+
+// requestBaseURL is the scheme and host the client used to reach the API
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
@@ -1,23 +1,28 @@
 package routes
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"rentx/models"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
+// Category writes are admin only (see RegisterRoutes)
 func createCategory(c *gin.Context) {
 	var category models.Category
 	if err := c.ShouldBindJSON(&category); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
 		return
 	}
-	userId := c.GetInt64("userId")
-	category.UserId = userId
 	if err := category.Save(); err != nil {
+		if respondCategoryError(c, err) {
+			return
+		}
 		fmt.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create category"})
 		return
@@ -26,34 +31,136 @@ func createCategory(c *gin.Context) {
 }
 
 func updateCategory(c *gin.Context) {
-	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
-	userId := c.GetInt64("userId")
+	id, ok := parseCategoryId(c)
+	if !ok {
+		return
+	}
+	// parentId: null moves the category to the top level, so an omitted
+	// parentId has to be told apart from a null one
 	var category models.Category
-	if err := c.ShouldBindJSON(&category); err != nil {
+	var fields map[string]json.RawMessage
+	if err := c.ShouldBindBodyWith(&category, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
 		return
 	}
+	if err := c.ShouldBindBodyWith(&fields, binding.JSON); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input"})
+		return
+	}
+	_, category.ParentSet = fields["parentId"]
 	category.Id = id
-	category.UserId = userId
-	if err := category.Update(userId); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+	if err := category.Update(); err != nil {
+		if respondCategoryError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not update category"})
 		return
 	}
 	c.JSON(http.StatusOK, category)
 }
 
+// deleteCategory only removes empty categories; posts are never deleted with them
 func deleteCategory(c *gin.Context) {
-	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
-	userId := c.GetInt64("userId")
-	category := models.Category{Id: id, UserId: userId}
-	if err := category.Delete(userId); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+	id, ok := parseCategoryId(c)
+	if !ok {
+		return
+	}
+	category := models.Category{Id: id}
+	if err := category.Delete(); err != nil {
+		if respondCategoryError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not delete category"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Deleted"})
 }
 
+// mergeCategory moves the category's posts and subcategories into targetId
+// and deletes it
+func mergeCategory(c *gin.Context) {
+	moveCategory(c, models.MergeCategory)
+}
+
+// reassignCategoryPosts moves the category's posts to targetId and keeps it
+func reassignCategoryPosts(c *gin.Context) {
+	moveCategory(c, models.ReassignCategoryPosts)
+}
+
+func moveCategory(c *gin.Context, move func(sourceId, targetId int64) (*models.CategoryMove, error)) {
+	id, ok := parseCategoryId(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		TargetId int64 `json:"targetId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input", "error": err.Error()})
+		return
+	}
+
+	result, err := move(id, body.TargetId)
+	if err != nil {
+		if respondCategoryError(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not move category content", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func parseCategoryId(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid category ID"})
+		return 0, false
+	}
+	return id, true
+}
+
 func listCategories(c *gin.Context) {
 	categories, _ := models.GetCategories()
 	c.JSON(http.StatusOK, categories)
 }
+
+// getCategoryTree returns every category nested under its parent, with counts
+// of approved posts including those in subcategories
+func getCategoryTree(c *gin.Context) {
+	tree, err := models.GetCategoryTree()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch categories"})
+		return
+	}
+	c.JSON(http.StatusOK, tree)
+}
+
+// getCategoryBySlug returns one category with its subcategories and counts
+func getCategoryBySlug(c *gin.Context) {
+	node, err := models.GetCategoryBySlug(c.Param("slug"))
+	if err != nil {
+		if errors.Is(err, models.ErrCategoryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch category"})
+		return
+	}
+	c.JSON(http.StatusOK, node)
+}
+
+// respondCategoryError answers validation errors; false means err is not one
+func respondCategoryError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, models.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, models.ErrInvalidCategory):
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	case errors.Is(err, models.ErrCategorySlugTaken), errors.Is(err, models.ErrCategoryInUse):
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+	default:
+		return false
+	}
+	return true
+}
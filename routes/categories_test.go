@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"rentx/db"
+	"rentx/models"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestUpdateCategoryParentId(t *testing.T) {
+	t.Chdir(t.TempDir()) // db.InitDB opens api.db in the working directory
+	t.Setenv("SUPERADMIN_NAME", "Admin")
+	t.Setenv("SUPERADMIN_EMAIL", "admin@example.com")
+	t.Setenv("SUPERADMIN_PHONE", "0000000000")
+	t.Setenv("SUPERADMIN_PASSWORD", "secret")
+	db.InitDB()
+	defer db.CloseDB()
+
+	parent := models.Category{Name: "Vehicles"}
+	if err := parent.Save(); err != nil {
+		t.Fatal(err)
+	}
+	child := models.Category{Name: "Cars", ParentId: &parent.Id}
+	if err := child.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/category/:id", updateCategory)
+	update := func(body string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPut, "/category/"+strconv.FormatInt(child.Id, 10), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("PUT %s: status %d: %s", body, w.Code, w.Body)
+		}
+	}
+	parentOf := func() *int64 {
+		t.Helper()
+		categories, err := models.GetCategories()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range categories {
+			if c.Id == child.Id {
+				return c.ParentId
+			}
+		}
+		t.Fatal("category not listed")
+		return nil
+	}
+
+	update(`{"name": "Motor Cars"}`)
+	if got := parentOf(); got == nil || *got != parent.Id {
+		t.Errorf("without parentId: parentId = %v, want %d", got, parent.Id)
+	}
+
+	update(`{"name": "Motor Cars", "parentId": null}`)
+	if got := parentOf(); got != nil {
+		t.Errorf("with parentId null: parentId = %d, want none", *got)
+	}
+
+	update(`{"name": "Motor Cars", "parentId": ` + strconv.FormatInt(parent.Id, 10) + `}`)
+	if got := parentOf(); got == nil || *got != parent.Id {
+		t.Errorf("with parentId: parentId = %v, want %d", got, parent.Id)
+	}
+}
@@ -0,0 +1,88 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"rentx/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ----------------- LIST CATEGORY ATTRIBUTES -----------------
+// The attributes posts of the category fill in, inherited ones included
+func listCategoryAttributes(c *gin.Context) {
+	attributes, err := models.GetCategoryAttributesBySlug(c.Param("slug"))
+	if err != nil {
+		respondCategoryAttributeError(c, err, "Could not fetch attributes")
+		return
+	}
+	c.JSON(http.StatusOK, attributes)
+}
+
+// ----------------- CREATE CATEGORY ATTRIBUTE -----------------
+func createCategoryAttribute(c *gin.Context) {
+	id, ok := parseCategoryId(c)
+	if !ok {
+		return
+	}
+	var attribute models.CategoryAttribute
+	if err := c.ShouldBindJSON(&attribute); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input", "error": err.Error()})
+		return
+	}
+	attribute.CategoryId = id
+
+	if err := attribute.Save(); err != nil {
+		respondCategoryAttributeError(c, err, "Could not create attribute")
+		return
+	}
+	c.JSON(http.StatusCreated, attribute)
+}
+
+// ----------------- UPDATE CATEGORY ATTRIBUTE -----------------
+func updateCategoryAttribute(c *gin.Context) {
+	id, ok := parseCategoryId(c)
+	if !ok {
+		return
+	}
+	var attribute models.CategoryAttribute
+	if err := c.ShouldBindJSON(&attribute); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input", "error": err.Error()})
+		return
+	}
+	attribute.CategoryId = id
+	attribute.Key = c.Param("key")
+
+	if err := attribute.Update(); err != nil {
+		respondCategoryAttributeError(c, err, "Could not update attribute")
+		return
+	}
+	c.JSON(http.StatusOK, attribute)
+}
+
+// ----------------- DELETE CATEGORY ATTRIBUTE -----------------
+// Values posts gave the attribute are removed with it
+func deleteCategoryAttribute(c *gin.Context) {
+	id, ok := parseCategoryId(c)
+	if !ok {
+		return
+	}
+	if err := models.DeleteCategoryAttribute(id, c.Param("key")); err != nil {
+		respondCategoryAttributeError(c, err, "Could not delete attribute")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Attribute deleted"})
+}
+
+func respondCategoryAttributeError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, models.ErrCategoryNotFound), errors.Is(err, models.ErrAttributeNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, models.ErrInvalidAttribute):
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	case errors.Is(err, models.ErrAttributeKeyTaken):
+		c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": message, "error": err.Error()})
+	}
+}
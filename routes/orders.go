@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 	"rentx/models"
 	"strconv"
@@ -15,8 +16,19 @@ func createOrder(c *gin.Context) {
 		return
 	}
 
+	order.UserId = c.GetInt64("userId") // from auth middleware, never the request body
+
 	if err := order.Create(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create order"})
+		switch {
+		case errors.Is(err, models.ErrBookingConflict), errors.Is(err, models.ErrDatesBlocked):
+			c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		case errors.Is(err, models.ErrPostNotBookable):
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		case errors.Is(err, models.ErrInvalidDates), errors.Is(err, models.ErrNoPricing), errors.Is(err, models.ErrOwnPost):
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create order"})
+		}
 		return
 	}
 	c.JSON(http.StatusCreated, order)
@@ -24,6 +36,10 @@ func createOrder(c *gin.Context) {
 
 func getOrderByID(c *gin.Context) {
 	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	if !authorizeOrderAccess(c, id) {
+		return
+	}
+
 	order, err := models.GetOrder(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
@@ -33,7 +49,7 @@ func getOrderByID(c *gin.Context) {
 }
 
 func listOrders(c *gin.Context) {
-	orders, err := models.ListOrders()
+	orders, err := models.ListOrders(c.GetInt64("userId"), c.GetString("role"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch orders"})
 		return
@@ -45,8 +61,113 @@ func deleteOrder(c *gin.Context) {
 	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
 	order := models.Order{Id: id}
 	if err := order.Delete(); err != nil {
+		if errors.Is(err, models.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Order and items deleted"})
 }
+
+func updateOrderStatus(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid order ID"})
+		return
+	}
+
+	var body struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input", "error": err.Error()})
+		return
+	}
+	if !models.IsValidOrderStatus(body.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown order status"})
+		return
+	}
+
+	order, err := models.TransitionOrder(id, body.Status, c.GetInt64("userId"), c.GetString("role"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		case errors.Is(err, models.ErrUnauthorized):
+			c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		case errors.Is(err, models.ErrInvalidTransition):
+			c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not update order status", "error": err.Error()})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, order)
+}
+
+func getOrderHistory(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid order ID"})
+		return
+	}
+
+	if !authorizeOrderAccess(c, id) {
+		return
+	}
+
+	history, err := models.ListOrderHistory(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch order history"})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// authorizeOrderAccess aborts with 404/403 unless the caller is the renter,
+// the post owner or an admin
+func authorizeOrderAccess(c *gin.Context, orderId int64) bool {
+	err := models.CanAccessOrder(orderId, c.GetInt64("userId"), c.GetString("role"))
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, models.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, models.ErrUnauthorized):
+		c.JSON(http.StatusForbidden, gin.H{"message": "not allowed"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch order"})
+	}
+	return false
+}
+
+// ----------------- OWNER BOOKINGS INBOX -----------------
+func listIncomingBookings(c *gin.Context) {
+	filter := models.BookingFilter{
+		Status: c.Query("status"),
+		From:   c.Query("from"),
+		To:     c.Query("to"),
+	}
+
+	bookings, err := models.ListIncomingBookings(c.GetInt64("userId"), filter)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch bookings", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, bookings)
+}
+
+func getBookingSummary(c *gin.Context) {
+	summary, err := models.GetBookingSummary(c.GetInt64("userId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch booking summary"})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
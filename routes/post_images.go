@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"rentx/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ----------------- ADD POST IMAGE -----------------
+func addPostImage(c *gin.Context) {
+	postId, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+
+	var in models.PostImageInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input", "error": err.Error()})
+		return
+	}
+
+	img, err := models.AddPostImage(postId, in, c.GetInt64("userId"), c.GetString("role"))
+	if err != nil {
+		respondPostImageError(c, err, "Could not add image")
+		return
+	}
+	c.JSON(http.StatusCreated, img)
+}
+
+// ----------------- EDIT ALT TEXT / CAPTION -----------------
+func updatePostImage(c *gin.Context) {
+	postId, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+	imageId, ok := parseImageId(c)
+	if !ok {
+		return
+	}
+
+	var text models.PostImageText
+	if err := c.ShouldBindJSON(&text); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input", "error": err.Error()})
+		return
+	}
+
+	img, err := models.UpdatePostImageText(postId, imageId, text, c.GetInt64("userId"), c.GetString("role"))
+	if err != nil {
+		respondPostImageError(c, err, "Could not update image")
+		return
+	}
+	c.JSON(http.StatusOK, img)
+}
+
+// ----------------- REMOVE POST IMAGE -----------------
+func removePostImage(c *gin.Context) {
+	postId, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+	imageId, ok := parseImageId(c)
+	if !ok {
+		return
+	}
+
+	if err := models.RemovePostImage(postId, imageId); err != nil {
+		respondPostImageError(c, err, "Could not remove image")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Image removed"})
+}
+
+// ----------------- REORDER POST IMAGES -----------------
+func reorderPostImages(c *gin.Context) {
+	postId, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		ImageIds []int64 `json:"imageIds" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input", "error": err.Error()})
+		return
+	}
+
+	images, err := models.ReorderPostImages(postId, body.ImageIds)
+	if err != nil {
+		respondPostImageError(c, err, "Could not reorder images")
+		return
+	}
+	c.JSON(http.StatusOK, images)
+}
+
+// ----------------- SET COVER IMAGE -----------------
+func setPostCoverImage(c *gin.Context) {
+	postId, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+	imageId, ok := parseImageId(c)
+	if !ok {
+		return
+	}
+
+	images, err := models.SetPostCoverImage(postId, imageId)
+	if err != nil {
+		respondPostImageError(c, err, "Could not set cover image")
+		return
+	}
+	c.JSON(http.StatusOK, images)
+}
+
+func parseImageId(c *gin.Context) (int64, bool) {
+	imageId, err := strconv.ParseInt(c.Param("imageId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid image ID"})
+		return 0, false
+	}
+	return imageId, true
+}
+
+func respondPostImageError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, models.ErrPostImageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case errors.Is(err, models.ErrInvalidPostImage), errors.Is(err, models.ErrImageNotOwned):
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": message, "error": err.Error()})
+	}
+}
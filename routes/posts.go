@@ -1,18 +1,35 @@
 package routes
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
 	"rentx/models"
+	"rentx/utils"
 	"strconv"
-	"time"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// uploadResult is the outcome for one uploaded file
+type uploadResult struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+	*models.Upload
+}
+
+// Files are checked by content, not name: only JPEG, PNG and WebP within the
+// size limits are accepted. Each is re-encoded without metadata into
+// thumb/medium/large variants stored next to the full-size image. Uploads
+// belong to the caller; those not used by a post are swept after UPLOAD_TTL.
 func uploadPostImages(c *gin.Context) {
+	// leave room for multipart headers on top of the file limits
+	maxBody := int64(utils.MaxImagesPerUpload*utils.MaxImageBytes + 1<<20)
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBody)
+
 	form, err := c.MultipartForm()
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to read form"})
@@ -24,30 +41,72 @@ func uploadPostImages(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "No files uploaded"})
 		return
 	}
-
-	saveDir := "storage/posts"
-	if err := os.MkdirAll(saveDir, os.ModePerm); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not create storage directory"})
+	if len(files) > utils.MaxImagesPerUpload {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("At most %d files per upload", utils.MaxImagesPerUpload)})
 		return
 	}
 
-	var urls []string
+	urls := []string{}
+	results := make([]uploadResult, 0, len(files))
 	for _, file := range files {
-		ext := filepath.Ext(file.Filename)
-		newFileName := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-		savePath := filepath.Join(saveDir, newFileName)
-		if err := c.SaveUploadedFile(file, savePath); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not save file"})
+		result := uploadResult{Name: file.Filename}
+
+		data, err := readUploadedFile(file)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		info, err := utils.InspectImage(data)
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+
+		upload, err := models.StoreImageUpload(c.GetInt64("userId"), data, info)
+		if errors.Is(err, models.ErrUnreadableImage) {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not save file", "error": err.Error()})
 			return
 		}
-		urls = append(urls, "/storage/posts/"+newFileName)
+		result.Upload = upload
+		urls = append(urls, upload.Url)
+		results = append(results, result)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"urls": urls,
+	status := http.StatusOK
+	if len(urls) == 0 {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{
+		"urls":  urls,
+		"files": results,
 	})
 }
 
+// readUploadedFile reads one multipart file, refusing files over the size limit
+func readUploadedFile(file *multipart.FileHeader) ([]byte, error) {
+	if file.Size > utils.MaxImageBytes {
+		return nil, fmt.Errorf("file is larger than %d MB", utils.MaxImageBytes>>20)
+	}
+	f, err := file.Open()
+	if err != nil {
+		return nil, errors.New("could not read file")
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, utils.MaxImageBytes+1))
+	if err != nil {
+		return nil, errors.New("could not read file")
+	}
+	return data, nil
+}
+
 // ----------------- CREATE POST -----------------
 func createPost(c *gin.Context) {
 	role := c.GetString("role")
@@ -86,6 +145,15 @@ func updatePost(c *gin.Context) {
 	role := c.GetString("role")
 
 	if err := p.Update(userId, role); err != nil {
+		if errors.Is(err, models.ErrInvalidLocation) || errors.Is(err, models.ErrImageNotOwned) ||
+			errors.Is(err, models.ErrInvalidPostAttribute) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		if errors.Is(err, models.ErrInvalidPostTransition) {
+			c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+			return
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
 		return
 	}
@@ -121,24 +189,185 @@ func getPostByID(c *gin.Context) {
 		return
 	}
 
-	post, err := models.GetPostByID(id)
+	// userId/role are only set when the optional token was sent
+	post, err := models.GetPostByID(id, c.GetInt64("userId"), c.GetString("role"))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		if errors.Is(err, models.ErrPostNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch post", "error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, post)
 }
 
+// ----------------- MY POSTS -----------------
+// Query: status (draft|pending|approved|rejected), all statuses when omitted
+func listMyPosts(c *gin.Context) {
+	status := c.Query("status")
+	if status != "" && !models.IsValidPostStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown post status"})
+		return
+	}
+
+	posts, err := models.ListOwnerPosts(c.GetInt64("userId"), status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch posts", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, posts)
+}
+
+func getMyPost(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid post ID"})
+		return
+	}
+
+	// admins use /posts/:id; here only the caller's own posts are found
+	post, err := models.GetPostByID(id, c.GetInt64("userId"), "")
+	if err == nil && post.UserId != c.GetInt64("userId") {
+		err = models.ErrPostNotFound
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrPostNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch post", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, post)
+}
+
+// ----------------- GET POST PRICE QUOTE -----------------
+func getPostQuote(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid post ID"})
+		return
+	}
+
+	quote, err := models.QuotePost(id, c.Query("startDate"), c.Query("endDate"))
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrPostNotBookable):
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		case errors.Is(err, models.ErrInvalidDates), errors.Is(err, models.ErrNoPricing):
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not calculate quote", "error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, quote)
+}
+
 // ----------------- LIST Approved POSTS -----------------
+// Query: categoryId (subcategories included), userId (owner), q (keyword),
+// attr (repeatable attribute filter, e.g. attr=seats>=5), period (daily|weekly|monthly), minPrice, maxPrice, addedAfter, addedBefore, lat + lng + radiusKm,
+// bbox (minLat,minLng,maxLat,maxLng), sort (newest|price_asc|price_desc|distance|rating),
+// cursor, limit
 func listApprovedPosts(c *gin.Context) {
-	posts, err := models.ListApprovedPosts()
+	filter := models.PostFilter{
+		Keyword:     c.Query("q"),
+		PricePeriod: c.Query("period"),
+		AddedAfter:  c.Query("addedAfter"),
+		AddedBefore: c.Query("addedBefore"),
+		Sort:        c.Query("sort"),
+		Cursor:      c.Query("cursor"),
+	}
+
+	var err error
+	if filter.CategoryId, err = queryInt64(c, "categoryId"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid categoryId"})
+		return
+	}
+	if filter.OwnerId, err = queryInt64(c, "userId"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid userId"})
+		return
+	}
+	for _, attr := range c.QueryArray("attr") {
+		f, err := models.ParseAttributeFilter(attr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		filter.Attributes = append(filter.Attributes, f)
+	}
+	if filter.MinPrice, err = queryFloat(c, "minPrice"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid minPrice"})
+		return
+	}
+	if filter.MaxPrice, err = queryFloat(c, "maxPrice"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid maxPrice"})
+		return
+	}
+	if filter.Near, err = queryPoint(c, "lat", "lng"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "lat and lng must be numbers and given together"})
+		return
+	}
+	radius, err := queryFloat(c, "radiusKm")
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid radiusKm"})
+		return
+	}
+	if radius != nil {
+		filter.RadiusKm = *radius
+	}
+	if filter.BBox, err = queryBBox(c, "bbox"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "bbox must be minLat,minLng,maxLat,maxLng"})
+		return
+	}
+	limit, err := queryInt64(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit"})
+		return
+	}
+	filter.Limit = int(limit)
+
+	page, err := models.SearchApprovedPosts(filter)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch posts", "error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, posts)
+	c.JSON(http.StatusOK, page)
+}
+
+// ----------------- FULL-TEXT SEARCH -----------------
+// Query: q (words, "phrases", prefix*), limit, offset
+func searchPosts(c *gin.Context) {
+	limit, err := queryInt64(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit"})
+		return
+	}
+	offset, err := queryInt64(c, "offset")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid offset"})
+		return
+	}
+
+	results, err := models.FullTextSearchPosts(c.Query("q"), int(limit), int(offset))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not search posts", "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
 }
 
 // ----------------- LIST PENDING POSTS -----------------
@@ -152,6 +381,7 @@ func listPendingPosts(c *gin.Context) {
 }
 
 // ----------------- UPDATE POST STATUS -----------------
+// Admin moderation: approve, reject (reason required) or archive a post
 func updatePostStatus(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -160,50 +390,138 @@ func updatePostStatus(c *gin.Context) {
 	}
 
 	var body struct {
-		Status string `json:"status" binding:"required"` // "approved" or "rejected"
+		Status string `json:"status" binding:"required"` // "approved", "rejected" or "archived"
+		Reason string `json:"reason"`                    // required when rejecting
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input", "error": err.Error()})
 		return
 	}
 
-	if body.Status != "approved" && body.Status != "rejected" {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Status must be 'approved' or 'rejected'"})
+	if body.Status != models.PostApproved && body.Status != models.PostRejected && body.Status != models.PostArchived {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Status must be 'approved', 'rejected' or 'archived'"})
+		return
+	}
+
+	moderatePost(c, id, body.Status, body.Reason)
+}
+
+// ----------------- RESUBMIT POST -----------------
+// Owner submits a draft, or sends a rejected post back after editing it, to the moderation queue
+func submitPost(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid post ID"})
+		return
+	}
+
+	moderatePost(c, id, models.PostPending, "")
+}
+
+// ----------------- POST MODERATION HISTORY -----------------
+func getPostModerationHistory(c *gin.Context) {
+	id, ok := authorizePostManagement(c)
+	if !ok {
+		return
+	}
+
+	history, err := models.ListPostModerationHistory(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch moderation history", "error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, history)
+}
 
-	// 1️⃣ Fetch current status
-	currentStatus, err := models.GetPostStatus(id)
+func moderatePost(c *gin.Context, id int64, status, reason string) {
+	err := models.ModeratePost(id, status, reason, c.GetInt64("userId"), c.GetString("role"))
 	if err != nil {
-		if err.Error() == "post not found" {
+		switch {
+		case errors.Is(err, models.ErrPostNotFound):
 			c.JSON(http.StatusNotFound, gin.H{"message": "Post not found"})
+		case errors.Is(err, models.ErrUnauthorized):
+			c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		case errors.Is(err, models.ErrReasonRequired):
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		case errors.Is(err, models.ErrInvalidPostTransition):
+			c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not update status", "error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Post status updated successfully", "status": status})
+}
+
+// ----------------- LIST ALL POSTS (admin) -----------------
+// Query: status (one or comma-separated), userId (owner), categoryId,
+// addedAfter, addedBefore, cursor, limit
+func listAllPosts(c *gin.Context) {
+	filter := models.AllPostsFilter{
+		AddedAfter:  c.Query("addedAfter"),
+		AddedBefore: c.Query("addedBefore"),
+		Cursor:      c.Query("cursor"),
+	}
+	if status := c.Query("status"); status != "" {
+		filter.Statuses = strings.Split(status, ",")
+	}
+
+	var err error
+	if filter.OwnerId, err = queryInt64(c, "userId"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid userId"})
+		return
+	}
+	if filter.CategoryId, err = queryInt64(c, "categoryId"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid categoryId"})
+		return
+	}
+	limit, err := queryInt64(c, "limit")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit"})
+		return
+	}
+	filter.Limit = int(limit)
+
+	page, err := models.ListAllPosts(filter)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidFilter) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch post status", "error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch posts", "error": err.Error()})
 		return
 	}
+	c.JSON(http.StatusOK, page)
+}
 
-	// 2️⃣ Check if already reviewed
-	if currentStatus == "approved" || currentStatus == "rejected" {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Post already reviewed by an admin"})
+// ----------------- BULK MODERATION (admin) -----------------
+func bulkModeratePosts(c *gin.Context) {
+	var body struct {
+		Action  string  `json:"action" binding:"required"` // approve | reject | archive | delete
+		PostIds []int64 `json:"postIds" binding:"required"`
+		Reason  string  `json:"reason"` // required when rejecting
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input", "error": err.Error()})
 		return
 	}
 
-	// 3️⃣ Update status
-	if err := models.UpdateStatus(id, body.Status); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not update status", "error": err.Error()})
+	results, err := models.BulkModeratePosts(body.Action, body.PostIds, body.Reason, c.GetInt64("userId"), c.GetString("role"))
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidBulkAction) || errors.Is(err, models.ErrReasonRequired) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not apply bulk action", "error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Post status updated successfully"})
+	succeeded := 0
+	for _, r := range results {
+		if r.Ok {
+			succeeded++
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"succeeded": succeeded, "failed": len(results) - succeeded, "results": results})
 }
-
-// // ----------------- LIST PENDING POSTS -----------------
-// func listAllPosts(c *gin.Context) {
-// 	posts, err := models.ListAllPosts()
-// 	if err != nil {
-// 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch posts", "error": err.Error()})
-// 		return
-// 	}
-// 	c.JSON(http.StatusOK, posts)
-// }
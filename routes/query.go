@@ -0,0 +1,78 @@
+package routes
+
+import (
+	"errors"
+	"math"
+	"rentx/geo"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryInt64 parses an optional integer query parameter; missing means 0
+func queryInt64(c *gin.Context, key string) (int64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// queryFloat parses an optional number query parameter; missing means nil.
+// NaN and infinities are rejected, since they slip through range checks.
+func queryFloat(c *gin.Context, key string) (*float64, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, errors.New(key + " must be a finite number")
+	}
+	return &f, nil
+}
+
+// queryPoint parses an optional coordinate from two query parameters that
+// must be given together; missing means nil
+func queryPoint(c *gin.Context, latKey, lngKey string) (*geo.Point, error) {
+	lat, err := queryFloat(c, latKey)
+	if err != nil {
+		return nil, err
+	}
+	lng, err := queryFloat(c, lngKey)
+	if err != nil {
+		return nil, err
+	}
+	if (lat == nil) != (lng == nil) {
+		return nil, errors.New(latKey + " and " + lngKey + " must be given together")
+	}
+	if lat == nil {
+		return nil, nil
+	}
+	return &geo.Point{Lat: *lat, Lng: *lng}, nil
+}
+
+// queryBBox parses an optional "minLat,minLng,maxLat,maxLng" query parameter
+func queryBBox(c *gin.Context, key string) (*geo.BBox, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return nil, errors.New(key + " needs four comma-separated numbers")
+	}
+	var n [4]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = f
+	}
+	return &geo.BBox{MinLat: n[0], MinLng: n[1], MaxLat: n[2], MaxLng: n[3]}, nil
+}
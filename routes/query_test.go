@@ -0,0 +1,42 @@
+package routes
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQueryFloat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	for _, c := range []struct {
+		value string
+		want  *float64
+		ok    bool
+	}{
+		{"", nil, true},
+		{"12.5", ptr(12.5), true},
+		{"-3", ptr(-3), true},
+		{"1e2", ptr(100), true},
+		{"abc", nil, false},
+		{"NaN", nil, false},
+		{"nan", nil, false},
+		{"Inf", nil, false},
+		{"-Infinity", nil, false},
+		{"1e999", nil, false}, // out of range
+	} {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("GET", "/?radiusKm="+url.QueryEscape(c.value), nil)
+		got, err := queryFloat(ctx, "radiusKm")
+		if (err == nil) != c.ok {
+			t.Errorf("queryFloat(%q): err = %v", c.value, err)
+			continue
+		}
+		if (got == nil) != (c.want == nil) || got != nil && *got != *c.want {
+			t.Errorf("queryFloat(%q) = %v, want %v", c.value, got, c.want)
+		}
+	}
+}
+
+func ptr(f float64) *float64 { return &f }
@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"errors"
 	"net/http"
 	"rentx/models"
 	"strconv"
@@ -8,7 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// Create a new review
+// Create a review of one of the caller's rentals (see models.Review.Save)
 func createReview(c *gin.Context) {
 	var r models.Review
 	if err := c.ShouldBindJSON(&r); err != nil {
@@ -19,7 +20,18 @@ func createReview(c *gin.Context) {
 	r.UserId = c.GetInt64("userId") // from middleware
 
 	if err := r.Save(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		switch {
+		case errors.Is(err, models.ErrInvalidReview):
+			c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		case errors.Is(err, models.ErrOrderNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		case errors.Is(err, models.ErrReviewNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		case errors.Is(err, models.ErrReviewExists):
+			c.JSON(http.StatusConflict, gin.H{"message": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		}
 		return
 	}
 
@@ -39,6 +51,46 @@ func listReviewsByPost(c *gin.Context) {
 	c.JSON(http.StatusOK, reviews)
 }
 
+// Rating summary of a post: average, count, reviews per star and sub-rating averages
+func getPostRatingSummary(c *gin.Context) {
+	postId, err := strconv.ParseInt(c.Param("postId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid post ID"})
+		return
+	}
+
+	summary, err := models.GetPostRatingSummary(postId)
+	if err != nil {
+		if errors.Is(err, models.ErrPostNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch rating"})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// Aggregate rating of an owner over the reviews of all their posts
+func getOwnerRatingSummary(c *gin.Context) {
+	ownerId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid user ID"})
+		return
+	}
+
+	summary, err := models.GetOwnerRatingSummary(ownerId)
+	if err != nil {
+		if errors.Is(err, models.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"message": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Could not fetch rating"})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
 // Delete a review (owner or admin only)
 func deleteReview(c *gin.Context) {
 	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
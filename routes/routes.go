@@ -14,10 +14,20 @@ func RegisterRoutes(server *gin.Engine) {
 	server.POST("/auth-oauth", oauthAuthHandler)
 
 	// categories
-	server.POST("/category", middlewares.Authenticate, createCategory)
-	server.PUT("/category/:id", middlewares.Authenticate, updateCategory)
-	server.DELETE("/category/:id", middlewares.Authenticate, deleteCategory)
+	server.POST("/category", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), createCategory)
+	server.PUT("/category/:id", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), updateCategory)
+	server.DELETE("/category/:id", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), deleteCategory)
+	server.POST("/category/:id/merge", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), mergeCategory)
+	server.POST("/category/:id/reassign", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), reassignCategoryPosts)
 	server.GET("/category", listCategories)
+	server.GET("/category/tree", getCategoryTree)
+	server.GET("/category/:slug", getCategoryBySlug)
+
+	// category attributes
+	server.GET("/category/:slug/attributes", listCategoryAttributes)
+	server.POST("/category/:id/attributes", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), createCategoryAttribute)
+	server.PUT("/category/:id/attributes/:key", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), updateCategoryAttribute)
+	server.DELETE("/category/:id/attributes/:key", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), deleteCategoryAttribute)
 
 	// posts
 	server.POST("/upload/post-image", middlewares.Authenticate, uploadPostImages)
@@ -25,20 +35,51 @@ func RegisterRoutes(server *gin.Engine) {
 	server.PUT("/posts/:id", middlewares.Authenticate, updatePost)
 	server.DELETE("/posts/:id", middlewares.Authenticate, deletePost)
 	server.GET("/approved-posts", listApprovedPosts)
-	server.GET("/posts/:id", getPostByID)
+	server.GET("/posts/search", searchPosts)
+	server.GET("/posts/:id", middlewares.OptionalAuthenticate, getPostByID)
+	server.GET("/posts/:id/quote", getPostQuote)
 	server.GET("/posts/pending", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), listPendingPosts)
 	server.PUT("/posts/:id/status", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), updatePostStatus)
-	// server.GET("/posts/all", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), listAllPosts)
+	server.POST("/posts/:id/submit", middlewares.Authenticate, submitPost)
+	server.GET("/posts/:id/moderation-history", middlewares.Authenticate, getPostModerationHistory)
+	server.GET("/my/posts", middlewares.Authenticate, listMyPosts)
+	server.GET("/my/posts/:id", middlewares.Authenticate, getMyPost)
+	server.GET("/posts/all", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), listAllPosts)
+	server.POST("/posts/bulk", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), bulkModeratePosts)
+
+	// post images
+	server.POST("/posts/:id/images", middlewares.Authenticate, addPostImage)
+	server.PUT("/posts/:id/images/order", middlewares.Authenticate, reorderPostImages)
+	server.PUT("/posts/:id/images/:imageId", middlewares.Authenticate, updatePostImage)
+	server.PUT("/posts/:id/images/:imageId/cover", middlewares.Authenticate, setPostCoverImage)
+	server.DELETE("/posts/:id/images/:imageId", middlewares.Authenticate, removePostImage)
+
+	// availability
+	server.GET("/posts/:id/calendar", getPostCalendar)
+	server.GET("/posts/:id/blackouts", middlewares.Authenticate, listBlackouts)
+	server.POST("/posts/:id/blackouts", middlewares.Authenticate, createBlackout)
+	server.DELETE("/posts/:id/blackouts/:blackoutId", middlewares.Authenticate, deleteBlackout)
+	server.GET("/ical/:file", getICalFeed)
+	server.GET("/posts/:id/ical", middlewares.Authenticate, getICalSettings)
+	server.PUT("/posts/:id/ical/import-url", middlewares.Authenticate, setICalImportURL)
+	server.POST("/posts/:id/ical/sync", middlewares.Authenticate, syncICalImport)
+	server.POST("/posts/:id/ical/upload", middlewares.Authenticate, uploadICalFile)
 
 	// orders
-	server.POST("/orders", createOrder)
-	server.DELETE("/orders/:id", deleteOrder)
-	server.GET("/orders", listOrders)
-	server.GET("/orders/:id", getOrderByID)
+	server.POST("/orders", middlewares.Authenticate, createOrder)
+	server.DELETE("/orders/:id", middlewares.Authenticate, middlewares.RequireRole("admin", "superadmin"), deleteOrder)
+	server.GET("/orders", middlewares.Authenticate, listOrders)
+	server.GET("/orders/:id", middlewares.Authenticate, getOrderByID)
+	server.PUT("/orders/:id/status", middlewares.Authenticate, updateOrderStatus)
+	server.GET("/orders/:id/history", middlewares.Authenticate, getOrderHistory)
+	server.GET("/owner/bookings", middlewares.Authenticate, listIncomingBookings)
+	server.GET("/owner/bookings/summary", middlewares.Authenticate, getBookingSummary)
 
 	// reviews
 	server.POST("/reviews", middlewares.Authenticate, createReview)
 	server.GET("/reviews/:postId", listReviewsByPost)
+	server.GET("/reviews/:postId/summary", getPostRatingSummary)
+	server.GET("/users/:id/rating", getOwnerRatingSummary)
 	server.DELETE("/reviews/:id", middlewares.Authenticate, deleteReview)
 
 }
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"errors"
+	"time"
+)
+
+// DateLayout is the calendar date format used for bookings (YYYY-MM-DD)
+const DateLayout = "2006-01-02"
+
+// ParseDate parses a YYYY-MM-DD string into a UTC date
+func ParseDate(value string) (time.Time, error) {
+	t, err := time.Parse(DateLayout, value)
+	if err != nil {
+		return time.Time{}, errors.New("dates must be formatted as YYYY-MM-DD")
+	}
+	return t, nil
+}
+
+// ParseDateRange parses an inclusive start/end date pair and checks its order
+func ParseDateRange(start, end string) (time.Time, time.Time, error) {
+	startDate, err := ParseDate(start)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	endDate, err := ParseDate(end)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if endDate.Before(startDate) {
+		return time.Time{}, time.Time{}, errors.New("end date must not be before start date")
+	}
+	return startDate, endDate, nil
+}
+
+const secondsPerDay = 24 * 60 * 60
+
+// DayCount returns the number of calendar days in an inclusive date range,
+// counted in whole Unix days so that long ranges do not overflow a Duration
+func DayCount(start, end time.Time) int {
+	return int(end.Unix()/secondsPerDay-start.Unix()/secondsPerDay) + 1
+}
+
+// Today returns the current UTC calendar date
+func Today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
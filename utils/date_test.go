@@ -0,0 +1,23 @@
+package utils
+
+import "testing"
+
+func TestDayCount(t *testing.T) {
+	for _, c := range []struct {
+		start, end string
+		want       int
+	}{
+		{"2026-11-01", "2026-11-01", 1},
+		{"2026-11-01", "2026-11-12", 12},
+		{"2028-02-28", "2028-03-01", 3},
+		{"2000-01-01", "2400-12-31", 146463},
+	} {
+		start, end, err := ParseDateRange(c.start, c.end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := DayCount(start, end); got != c.want {
+			t.Errorf("DayCount(%s, %s) = %d, want %d", c.start, c.end, got, c.want)
+		}
+	}
+}
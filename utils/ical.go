@@ -0,0 +1,218 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ICalEvent is an all-day calendar event covering StartDate..EndDate
+// (inclusive). Recurring events list their first instance; see Occurrences.
+type ICalEvent struct {
+	UID        string
+	Summary    string
+	StartDate  time.Time
+	EndDate    time.Time
+	Recurrence *ICalRecurrence // nil for one-off events
+}
+
+const icalDateLayout = "20060102"
+
+// ParseICal reads the VEVENTs of an iCalendar (RFC 5545) document as
+// all-day ranges. Timed events are widened to the dates they touch; an
+// exclusive DTEND at midnight does not count as an extra day. Cancelled
+// events and events without a DTSTART are skipped. Recurrence rules are kept
+// on the event; unsupported ones are an error (see ICalRecurrence).
+func ParseICal(r io.Reader) ([]ICalEvent, error) {
+	lines, err := unfoldICalLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []ICalEvent
+	var inEvent, sawCalendar bool
+	var ev ICalEvent
+	var hasStart, cancelled bool
+	var endValue, rule string
+	var endIsDate bool
+	var extraDates, exceptDates []time.Time
+
+	for _, line := range lines {
+		name, value, ok := splitICalProperty(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VCALENDAR"):
+			sawCalendar = true
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			inEvent = true
+			ev = ICalEvent{}
+			hasStart, cancelled, endValue, endIsDate, rule = false, false, "", false, ""
+			extraDates, exceptDates = nil, nil
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			inEvent = false
+			if !hasStart || cancelled {
+				continue
+			}
+			ev.EndDate = ev.StartDate
+			if endValue != "" {
+				end, err := parseICalDate(endValue)
+				if err != nil {
+					return nil, fmt.Errorf("event %q: invalid DTEND: %w", ev.UID, err)
+				}
+				// DTEND is exclusive: an all-day end or a timed end at midnight
+				// means the previous day is the last one
+				if endIsDate || strings.HasSuffix(strings.TrimSuffix(endValue, "Z"), "T000000") {
+					end = end.AddDate(0, 0, -1)
+				}
+				if !end.Before(ev.StartDate) {
+					ev.EndDate = end
+				}
+			}
+			if rule != "" {
+				if ev.Recurrence, err = parseICalRule(rule); err != nil {
+					return nil, fmt.Errorf("event %q: %w", ev.UID, err)
+				}
+			}
+			if len(extraDates) > 0 || len(exceptDates) > 0 {
+				if ev.Recurrence == nil {
+					ev.Recurrence = &ICalRecurrence{}
+				}
+				ev.Recurrence.Dates, ev.Recurrence.Except = extraDates, exceptDates
+			}
+			events = append(events, ev)
+		case !inEvent:
+		case name == "UID":
+			ev.UID = value
+		case name == "SUMMARY":
+			ev.Summary = unescapeICalText(value)
+		case name == "STATUS":
+			cancelled = strings.EqualFold(value, "CANCELLED")
+		case name == "DTSTART":
+			start, err := parseICalDate(value)
+			if err != nil {
+				return nil, fmt.Errorf("event %q: invalid DTSTART: %w", ev.UID, err)
+			}
+			ev.StartDate = start
+			hasStart = true
+		case name == "DTEND":
+			endValue = value
+			endIsDate = len(value) == len(icalDateLayout) // DATE rather than DATE-TIME
+		case name == "RRULE":
+			rule = value
+		case name == "RDATE", name == "EXDATE":
+			dates, err := parseICalDateList(value)
+			if err != nil {
+				return nil, fmt.Errorf("event %q: invalid %s: %w", ev.UID, name, err)
+			}
+			if name == "RDATE" {
+				extraDates = append(extraDates, dates...)
+			} else {
+				exceptDates = append(exceptDates, dates...)
+			}
+		}
+	}
+
+	if !sawCalendar {
+		return nil, errors.New("not an iCalendar file")
+	}
+	return events, nil
+}
+
+// WriteICal writes events as an all-day iCalendar feed
+func WriteICal(w io.Writer, calendarName string, events []ICalEvent) error {
+	bw := bufio.NewWriter(w)
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+
+	write := func(line string) {
+		// fold lines longer than 75 octets (RFC 5545 §3.1)
+		for len(line) > 75 {
+			cut := 75
+			for cut > 0 && !isUTF8Start(line[cut]) {
+				cut--
+			}
+			bw.WriteString(line[:cut] + "\r\n")
+			line = " " + line[cut:]
+		}
+		bw.WriteString(line + "\r\n")
+	}
+
+	write("BEGIN:VCALENDAR")
+	write("VERSION:2.0")
+	write("PRODID:-//RentX//Availability//EN")
+	write("CALSCALE:GREGORIAN")
+	write("METHOD:PUBLISH")
+	write("X-WR-CALNAME:" + escapeICalText(calendarName))
+	for _, ev := range events {
+		write("BEGIN:VEVENT")
+		write("UID:" + ev.UID)
+		write("DTSTAMP:" + stamp)
+		write("DTSTART;VALUE=DATE:" + ev.StartDate.Format(icalDateLayout))
+		write("DTEND;VALUE=DATE:" + ev.EndDate.AddDate(0, 0, 1).Format(icalDateLayout))
+		write("SUMMARY:" + escapeICalText(ev.Summary))
+		write("TRANSP:OPAQUE")
+		write("END:VEVENT")
+	}
+	write("END:VCALENDAR")
+
+	return bw.Flush()
+}
+
+func unfoldICalLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitICalProperty splits "NAME;PARAM=X:value" into its name and value;
+// parameters are not needed for all-day ranges and are dropped
+func splitICalProperty(line string) (name, value string, ok bool) {
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return "", "", false
+	}
+	head := line[:colon]
+	value = strings.TrimSpace(line[colon+1:])
+	if semi := strings.IndexByte(head, ';'); semi >= 0 {
+		head = head[:semi]
+	}
+	return strings.ToUpper(head), value, true
+}
+
+// parseICalDate takes the calendar date of a DATE or DATE-TIME value
+func parseICalDate(value string) (time.Time, error) {
+	if len(value) < len(icalDateLayout) {
+		return time.Time{}, fmt.Errorf("unexpected value %q", value)
+	}
+	return time.Parse(icalDateLayout, value[:len(icalDateLayout)])
+}
+
+var icalTextEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+var icalTextUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+func escapeICalText(s string) string {
+	return icalTextEscaper.Replace(s)
+}
+
+func unescapeICalText(s string) string {
+	return icalTextUnescaper.Replace(s)
+}
+
+func isUTF8Start(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ICalRecurrence repeats an event (RRULE, RDATE and EXDATE). Only rules made
+// of FREQ, INTERVAL, COUNT, UNTIL, WKST and, for weekly rules, plain BYDAY
+// weekdays are supported; ParseICal rejects others rather than blocking fewer
+// days than the event covers.
+type ICalRecurrence struct {
+	Freq      string // DAILY, WEEKLY, MONTHLY or YEARLY; empty when only RDATE is set
+	Interval  int
+	Count     int       // 0 for no limit
+	Until     time.Time // inclusive; zero for no limit
+	Weekdays  []time.Weekday
+	WeekStart time.Weekday
+	Dates     []time.Time // RDATE: extra start dates
+	Except    []time.Time // EXDATE: start dates left out
+}
+
+// maxRecurrencePeriods bounds the expansion of a rule, which only comes
+// close for COUNT rules starting far in the past
+const maxRecurrencePeriods = 100000
+
+var icalWeekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// parseICalRule reads an RRULE value such as FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE
+func parseICalRule(value string) (*ICalRecurrence, error) {
+	rec := &ICalRecurrence{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(value, ";") {
+		name, v, _ := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		v = strings.ToUpper(strings.TrimSpace(v))
+		switch name {
+		case "FREQ":
+			rec.Freq = v
+		case "INTERVAL":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid RRULE INTERVAL %q", v)
+			}
+			rec.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid RRULE COUNT %q", v)
+			}
+			rec.Count = n
+		case "UNTIL":
+			until, err := parseICalDate(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RRULE UNTIL: %w", err)
+			}
+			rec.Until = until
+		case "WKST":
+			day, ok := icalWeekdays[v]
+			if !ok {
+				return nil, fmt.Errorf("invalid RRULE WKST %q", v)
+			}
+			rec.WeekStart = day
+		case "BYDAY":
+			for _, code := range strings.Split(v, ",") {
+				day, ok := icalWeekdays[code]
+				if !ok {
+					return nil, fmt.Errorf("unsupported RRULE BYDAY %q", v)
+				}
+				rec.Weekdays = append(rec.Weekdays, day)
+			}
+		case "":
+		default:
+			if !strings.HasPrefix(name, "X-") {
+				return nil, fmt.Errorf("unsupported RRULE part %s", name)
+			}
+		}
+	}
+
+	switch rec.Freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	case "":
+		return nil, errors.New("RRULE without FREQ")
+	default:
+		return nil, fmt.Errorf("unsupported RRULE FREQ %s", rec.Freq)
+	}
+	if len(rec.Weekdays) > 0 && rec.Freq != "WEEKLY" {
+		return nil, fmt.Errorf("unsupported RRULE BYDAY with FREQ %s", rec.Freq)
+	}
+	return rec, nil
+}
+
+// parseICalDateList reads a comma-separated RDATE or EXDATE value
+func parseICalDateList(value string) ([]time.Time, error) {
+	var dates []time.Time
+	for _, v := range strings.Split(value, ",") {
+		d, err := parseICalDate(strings.TrimSpace(v))
+		if err != nil {
+			return nil, err
+		}
+		dates = append(dates, d)
+	}
+	return dates, nil
+}
+
+// Occurrences returns the instances of the event, without Recurrence, that
+// overlap from..until (inclusive). A one-off event is its own instance.
+func (ev ICalEvent) Occurrences(from, until time.Time) ([]ICalEvent, error) {
+	rec := ev.Recurrence
+	length := DayCount(ev.StartDate, ev.EndDate) - 1
+	seen := map[time.Time]bool{}
+	var out []ICalEvent
+	add := func(start time.Time) {
+		end := start.AddDate(0, 0, length)
+		if seen[start] || end.Before(from) || start.After(until) {
+			return
+		}
+		seen[start] = true
+		if rec != nil && slices.ContainsFunc(rec.Except, start.Equal) {
+			return
+		}
+		out = append(out, ICalEvent{UID: ev.UID, Summary: ev.Summary, StartDate: start, EndDate: end})
+	}
+
+	if rec == nil || rec.Freq == "" {
+		add(ev.StartDate)
+		if rec != nil {
+			for _, d := range rec.Dates {
+				add(d)
+			}
+		}
+		return out, nil
+	}
+	for _, d := range rec.Dates {
+		add(d)
+	}
+
+	// without COUNT, periods ending before the window need not be walked
+	first := 0
+	if rec.Count == 0 {
+		first = max(rec.periodsBefore(ev.StartDate, from.AddDate(0, 0, -length))-1, 0)
+	}
+	count := 0
+	for p := first; ; p++ {
+		if p-first > maxRecurrencePeriods {
+			return nil, fmt.Errorf("event %q: recurrence too long to expand", ev.UID)
+		}
+		periodStart, starts := rec.period(ev.StartDate, p)
+		if periodStart.After(until) || (!rec.Until.IsZero() && periodStart.After(rec.Until)) {
+			return out, nil
+		}
+		for _, start := range starts {
+			if rec.Count > 0 && count >= rec.Count || !rec.Until.IsZero() && start.After(rec.Until) {
+				return out, nil
+			}
+			count++
+			add(start)
+		}
+	}
+}
+
+// period returns the first day of the p-th period of the rule and the start
+// dates it holds; months without the start's day of month hold none
+func (rec *ICalRecurrence) period(start time.Time, p int) (time.Time, []time.Time) {
+	n := p * rec.Interval
+	switch rec.Freq {
+	case "DAILY":
+		d := start.AddDate(0, 0, n)
+		return d, []time.Time{d}
+	case "WEEKLY":
+		if len(rec.Weekdays) == 0 {
+			d := start.AddDate(0, 0, 7*n)
+			return d, []time.Time{d}
+		}
+		week := rec.weekOf(start).AddDate(0, 0, 7*n)
+		var starts []time.Time
+		if p == 0 {
+			starts = append(starts, start) // DTSTART is always the first instance
+		}
+		for offset := range 7 {
+			d := week.AddDate(0, 0, offset)
+			if slices.Contains(rec.Weekdays, d.Weekday()) && d.After(start) {
+				starts = append(starts, d)
+			}
+		}
+		return week, starts
+	case "MONTHLY":
+		month := time.Date(start.Year(), start.Month()+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+		return month, sameDay(month, start.Day())
+	default: // YEARLY
+		year := time.Date(start.Year()+n, start.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return year, sameDay(year, start.Day())
+	}
+}
+
+// periodsBefore is the number of whole periods from start to date
+func (rec *ICalRecurrence) periodsBefore(start, date time.Time) int {
+	if !date.After(start) {
+		return 0
+	}
+	switch rec.Freq {
+	case "DAILY":
+		return (DayCount(start, date) - 1) / rec.Interval
+	case "WEEKLY":
+		return (DayCount(rec.weekOf(start), date) - 1) / (7 * rec.Interval)
+	case "MONTHLY":
+		return ((date.Year()-start.Year())*12 + int(date.Month()-start.Month())) / rec.Interval
+	default:
+		return (date.Year() - start.Year()) / rec.Interval
+	}
+}
+
+// weekOf returns the first day of the week holding d
+func (rec *ICalRecurrence) weekOf(d time.Time) time.Time {
+	return d.AddDate(0, 0, -((int(d.Weekday())-int(rec.WeekStart))+7)%7)
+}
+
+// sameDay returns the day of the month of first, if the month has it
+func sameDay(first time.Time, day int) []time.Time {
+	d := first.AddDate(0, 0, day-1)
+	if d.Month() != first.Month() {
+		return nil
+	}
+	return []time.Time{d}
+}
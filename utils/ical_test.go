@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+// icalDoc wraps event lines in a calendar, with CRLF line endings
+func icalDoc(lines ...string) string {
+	all := append(append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...), "END:VCALENDAR")
+	return strings.Join(all, "\r\n") + "\r\n"
+}
+
+func date(s string) time.Time {
+	d, err := ParseDate(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// span formats the dates of an event as "start..end"
+func span(ev ICalEvent) string {
+	return ev.StartDate.Format(DateLayout) + ".." + ev.EndDate.Format(DateLayout)
+}
+
+func TestParseICal(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		lines   []string
+		span    string // "" when the event is skipped
+		summary string
+	}{
+		{"all-day DTEND is exclusive", []string{
+			"DTSTART;VALUE=DATE:20261104", "DTEND;VALUE=DATE:20261107",
+		}, "2026-11-04..2026-11-06", ""},
+		{"all-day without DTEND", []string{
+			"DTSTART;VALUE=DATE:20261104",
+		}, "2026-11-04..2026-11-04", ""},
+		{"DTEND on DTSTART", []string{
+			"DTSTART;VALUE=DATE:20261104", "DTEND;VALUE=DATE:20261104",
+		}, "2026-11-04..2026-11-04", ""},
+		{"timed, ending at midnight", []string{
+			"DTSTART:20261104T150000Z", "DTEND:20261106T000000Z",
+		}, "2026-11-04..2026-11-05", ""},
+		{"timed, ending the next morning", []string{
+			"DTSTART;TZID=Europe/Berlin:20261104T220000", "DTEND;TZID=Europe/Berlin:20261105T100000",
+		}, "2026-11-04..2026-11-05", ""},
+		{"folded and escaped summary", []string{
+			"DTSTART;VALUE=DATE:20261104", "SUMMARY:Repair\\, cleaning and a", "  long\\nnote",
+		}, "2026-11-04..2026-11-04", "Repair, cleaning and a long\nnote"},
+		{"cancelled", []string{
+			"DTSTART;VALUE=DATE:20261104", "STATUS:CANCELLED",
+		}, "", ""},
+		{"without DTSTART", []string{
+			"SUMMARY:No date",
+		}, "", ""},
+	} {
+		lines := append(append([]string{"BEGIN:VEVENT", "UID:event-1"}, c.lines...), "END:VEVENT")
+		events, err := ParseICal(strings.NewReader(icalDoc(lines...)))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if c.span == "" {
+			if len(events) != 0 {
+				t.Errorf("%s: got %d events, want none", c.name, len(events))
+			}
+			continue
+		}
+		if len(events) != 1 {
+			t.Errorf("%s: got %d events, want 1", c.name, len(events))
+			continue
+		}
+		if got := span(events[0]); got != c.span {
+			t.Errorf("%s: dates = %s, want %s", c.name, got, c.span)
+		}
+		if events[0].UID != "event-1" || events[0].Summary != c.summary {
+			t.Errorf("%s: uid, summary = %q, %q, want %q, %q", c.name, events[0].UID, events[0].Summary, "event-1", c.summary)
+		}
+		if events[0].Recurrence != nil {
+			t.Errorf("%s: unexpected recurrence", c.name)
+		}
+	}
+}
+
+func TestParseICalErrors(t *testing.T) {
+	for name, doc := range map[string]string{
+		"not a calendar":  "BEGIN:VEVENT\r\nDTSTART;VALUE=DATE:20261104\r\nEND:VEVENT\r\n",
+		"bad DTSTART":     icalDoc("BEGIN:VEVENT", "DTSTART:tomorrow", "END:VEVENT"),
+		"bad DTEND":       icalDoc("BEGIN:VEVENT", "DTSTART:20261104", "DTEND:x", "END:VEVENT"),
+		"bad EXDATE":      icalDoc("BEGIN:VEVENT", "DTSTART:20261104", "RRULE:FREQ=DAILY", "EXDATE:x", "END:VEVENT"),
+		"RRULE BY parts":  icalDoc("BEGIN:VEVENT", "DTSTART:20261104", "RRULE:FREQ=MONTHLY;BYMONTHDAY=1,15", "END:VEVENT"),
+		"RRULE ordinal":   icalDoc("BEGIN:VEVENT", "DTSTART:20261104", "RRULE:FREQ=WEEKLY;BYDAY=1MO", "END:VEVENT"),
+		"RRULE hourly":    icalDoc("BEGIN:VEVENT", "DTSTART:20261104", "RRULE:FREQ=HOURLY", "END:VEVENT"),
+		"RRULE no FREQ":   icalDoc("BEGIN:VEVENT", "DTSTART:20261104", "RRULE:COUNT=3", "END:VEVENT"),
+		"RRULE bad COUNT": icalDoc("BEGIN:VEVENT", "DTSTART:20261104", "RRULE:FREQ=DAILY;COUNT=0", "END:VEVENT"),
+	} {
+		if _, err := ParseICal(strings.NewReader(doc)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestICalOccurrences(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		lines    []string
+		from, to string
+		want     []string
+	}{
+		{"one-off in the window", []string{"DTSTART;VALUE=DATE:20270105"},
+			"2027-01-01", "2027-12-31", []string{"2027-01-05..2027-01-05"}},
+		{"one-off before the window", []string{"DTSTART;VALUE=DATE:20261205"},
+			"2027-01-01", "2027-12-31", nil},
+		{"daily count", []string{"DTSTART;VALUE=DATE:20270101", "RRULE:FREQ=DAILY;COUNT=3"},
+			"2027-01-01", "2027-12-31", []string{"2027-01-01..2027-01-01", "2027-01-02..2027-01-02", "2027-01-03..2027-01-03"}},
+		{"daily interval until", []string{"DTSTART;VALUE=DATE:20270101", "RRULE:FREQ=DAILY;INTERVAL=3;UNTIL=20270107T235959Z"},
+			"2027-01-01", "2027-12-31", []string{"2027-01-01..2027-01-01", "2027-01-04..2027-01-04", "2027-01-07..2027-01-07"}},
+		{"weekly by day", []string{"DTSTART;VALUE=DATE:20270104", "RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4"},
+			"2027-01-01", "2027-12-31", []string{"2027-01-04..2027-01-04", "2027-01-06..2027-01-06", "2027-01-11..2027-01-11", "2027-01-13..2027-01-13"}},
+		{"fortnightly", []string{"DTSTART;VALUE=DATE:20270101", "RRULE:FREQ=WEEKLY;INTERVAL=2;COUNT=3"},
+			"2027-01-01", "2027-12-31", []string{"2027-01-01..2027-01-01", "2027-01-15..2027-01-15", "2027-01-29..2027-01-29"}},
+		{"monthly skips short months", []string{"DTSTART;VALUE=DATE:20270131", "RRULE:FREQ=MONTHLY;COUNT=3"},
+			"2027-01-01", "2027-12-31", []string{"2027-01-31..2027-01-31", "2027-03-31..2027-03-31", "2027-05-31..2027-05-31"}},
+		{"yearly on a leap day", []string{"DTSTART;VALUE=DATE:20280229", "RRULE:FREQ=YEARLY;UNTIL=20361231"},
+			"2028-01-01", "2040-12-31", []string{"2028-02-29..2028-02-29", "2032-02-29..2032-02-29", "2036-02-29..2036-02-29"}},
+		{"EXDATE and RDATE", []string{"DTSTART;VALUE=DATE:20270101", "RRULE:FREQ=DAILY;COUNT=3",
+			"EXDATE;VALUE=DATE:20270102", "RDATE;VALUE=DATE:20270110"},
+			"2027-01-01", "2027-12-31", []string{"2027-01-10..2027-01-10", "2027-01-01..2027-01-01", "2027-01-03..2027-01-03"}},
+		{"RDATE only", []string{"DTSTART;VALUE=DATE:20270101", "RDATE;VALUE=DATE:20270110,20270120"},
+			"2027-01-01", "2027-12-31", []string{"2027-01-01..2027-01-01", "2027-01-10..2027-01-10", "2027-01-20..2027-01-20"}},
+		{"multi-day instances overlapping the window", []string{"DTSTART;VALUE=DATE:20261230", "DTEND;VALUE=DATE:20270102",
+			"RRULE:FREQ=WEEKLY"},
+			"2027-01-01", "2027-01-10", []string{"2026-12-30..2027-01-01", "2027-01-06..2027-01-08"}},
+		{"daily since year 1, no count", []string{"DTSTART;VALUE=DATE:00010101", "RRULE:FREQ=DAILY"},
+			"2027-01-01", "2027-01-02", []string{"2027-01-01..2027-01-01", "2027-01-02..2027-01-02"}},
+	} {
+		lines := append(append([]string{"BEGIN:VEVENT", "UID:event-1"}, c.lines...), "END:VEVENT")
+		events, err := ParseICal(strings.NewReader(icalDoc(lines...)))
+		if err != nil || len(events) != 1 {
+			t.Errorf("%s: ParseICal = %d events, %v", c.name, len(events), err)
+			continue
+		}
+		occurrences, err := events[0].Occurrences(date(c.from), date(c.to))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		var got []string
+		for _, o := range occurrences {
+			got = append(got, span(o))
+			if o.Recurrence != nil || o.UID != "event-1" {
+				t.Errorf("%s: occurrence %+v", c.name, o)
+			}
+		}
+		if strings.Join(got, " ") != strings.Join(c.want, " ") {
+			t.Errorf("%s: occurrences = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestWriteICal(t *testing.T) {
+	events := []ICalEvent{
+		{UID: "order-1@rentx", Summary: "Booked", StartDate: date("2026-11-04"), EndDate: date("2026-11-06")},
+		{UID: "blackout-2@rentx", Summary: strings.Repeat("Wartung, Reinigung; Überprüfung. ", 3) + "Fertig",
+			StartDate: date("2026-12-24"), EndDate: date("2026-12-24")},
+	}
+	var buf bytes.Buffer
+	if err := WriteICal(&buf, "Bike; city", events); err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.String()
+
+	for _, line := range strings.Split(strings.TrimSuffix(doc, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+	}
+	for _, want := range []string{
+		"X-WR-CALNAME:Bike\\; city\r\n",
+		"DTSTART;VALUE=DATE:20261104\r\nDTEND;VALUE=DATE:20261107\r\n",
+		"DTSTART;VALUE=DATE:20261224\r\nDTEND;VALUE=DATE:20261225\r\n",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("feed lacks %q", want)
+		}
+	}
+
+	parsed, err := ParseICal(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(events) {
+		t.Fatalf("read back %d events, want %d", len(parsed), len(events))
+	}
+	for i := range events {
+		if parsed[i].UID != events[i].UID || parsed[i].Summary != events[i].Summary || span(parsed[i]) != span(events[i]) {
+			t.Errorf("event %d read back as %+v, want %+v", i, parsed[i], events[i])
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/gabriel-vasile/mimetype"
+	_ "golang.org/x/image/webp"
+)
+
+// Image upload limits
+const (
+	MaxImageBytes      = 10 << 20 // per file
+	MaxImageDimension  = 8000     // pixels per side
+	MaxImagesPerUpload = 10
+)
+
+// allowedImageTypes are the accepted upload content types
+var allowedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/webp": true,
+}
+
+// ImageInfo describes an accepted image upload
+type ImageInfo struct {
+	MIME   string
+	Width  int
+	Height int
+}
+
+// InspectImage sniffs the content type of an uploaded file, ignoring its name
+// and the client's Content-Type, and checks it is a JPEG, PNG or WebP image
+// within the size limits
+func InspectImage(data []byte) (ImageInfo, error) {
+	if len(data) > MaxImageBytes {
+		return ImageInfo{}, fmt.Errorf("file is larger than %d MB", MaxImageBytes>>20)
+	}
+
+	mime := mimetype.Detect(data).String()
+	if !allowedImageTypes[mime] {
+		return ImageInfo{}, fmt.Errorf("unsupported file type %s; allowed: JPEG, PNG, WebP", mime)
+	}
+	info := ImageInfo{MIME: mime}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("unreadable image: %v", err)
+	}
+	info.Width, info.Height = cfg.Width, cfg.Height
+
+	if info.Width <= 0 || info.Height <= 0 {
+		return ImageInfo{}, errors.New("image has no pixels")
+	}
+	if info.Width > MaxImageDimension || info.Height > MaxImageDimension {
+		return ImageInfo{}, fmt.Errorf("image is %dx%d pixels; at most %d per side", info.Width, info.Height, MaxImageDimension)
+	}
+	return info, nil
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+)
+
+// ImageVariantSizes are the resized copies made of every upload, by longest side
+var ImageVariantSizes = []struct {
+	Name    string
+	MaxSide int
+}{
+	{"large", 1600},
+	{"medium", 800},
+	{"thumb", 320},
+}
+
+// OriginalVariant names the full-size re-encoded upload
+const OriginalVariant = "original"
+
+// EncodedImage is one re-encoded rendition of an upload
+type EncodedImage struct {
+	Variant string
+	MIME    string
+	Ext     string
+	Data    []byte
+	Width   int
+	Height  int
+}
+
+// ProcessImage decodes an inspected upload, turns it upright according to its
+// EXIF orientation and re-encodes the full-size original plus every size in
+// ImageVariantSizes. Re-encoding drops all metadata, GPS position included.
+// Opaque images become JPEG; images with transparency stay PNG, and every
+// variant keeps the format of the original.
+func ProcessImage(data []byte, info ImageInfo) ([]EncodedImage, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if info.MIME == "image/jpeg" {
+		src = applyOrientation(src, jpegOrientation(data))
+	}
+
+	opaque := isOpaque(src)
+	original, err := encodeImage(OriginalVariant, src, opaque)
+	if err != nil {
+		return nil, err
+	}
+	images := []EncodedImage{original}
+
+	for _, size := range ImageVariantSizes {
+		variant, err := encodeImage(size.Name, scaleToFit(src, size.MaxSide), opaque)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, variant)
+	}
+	return images, nil
+}
+
+// scaleToFit shrinks img so its longest side is at most maxSide; smaller
+// images are returned as they are
+func scaleToFit(img image.Image, maxSide int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxSide && h <= maxSide {
+		return img
+	}
+	if w >= h {
+		h = max(1, h*maxSide/w)
+		w = maxSide
+	} else {
+		w = max(1, w*maxSide/h)
+		h = maxSide
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+func encodeImage(variant string, img image.Image, asJPEG bool) (EncodedImage, error) {
+	var buf bytes.Buffer
+	mime, ext := "image/png", ".png"
+	var err error
+	if asJPEG {
+		mime, ext = "image/jpeg", ".jpg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return EncodedImage{}, err
+	}
+	b := img.Bounds()
+	return EncodedImage{Variant: variant, MIME: mime, Ext: ext, Data: buf.Bytes(), Width: b.Dx(), Height: b.Dy()}, nil
+}
+
+func isOpaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, 1 when absent
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // image data starts; no EXIF before it
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return 1
+		}
+		segment := data[i+4 : end]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+		i = end
+	}
+	return 1
+}
+
+// tiffOrientation reads tag 0x0112 from the first IFD of an EXIF TIFF block
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd : ifd+2]))
+	for n := 0; n < entries; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:entry+2]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8 : entry+10])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation rotates/flips img so that it displays upright without
+// its EXIF orientation tag
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if orientation >= 5 { // 5-8 swap width and height
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				dx, dy = w-1-x, y
+			case 3: // rotated 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise to display
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise to display
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Slugify turns a name into a lower-case URL slug of letters and digits
+// separated by single dashes, e.g. "Cars & Vans" → "cars-vans". Accents on
+// Latin letters are dropped ("Café" → "cafe"); other scripts are kept as they
+// are, marks included, so Bengali names still give a readable slug.
+func Slugify(s string) string {
+	var b strings.Builder
+	dash, afterLatin := false, false
+	for _, r := range norm.NFKD.String(strings.ToLower(s)) {
+		switch {
+		case unicode.In(r, unicode.Mn, unicode.Mc):
+			if !afterLatin && b.Len() > 0 && !dash {
+				b.WriteRune(r)
+			}
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			dash = false
+			afterLatin = r < unicode.MaxASCII
+			b.WriteRune(r)
+		default:
+			dash = true
+		}
+	}
+	return norm.NFC.String(b.String())
+}
+
+// UniqueSlug slugifies name and appends -2, -3, ... until taken reports the
+// slug as free. Names without letters or digits fall back to fallback.
+func UniqueSlug(name, fallback string, taken func(slug string) (bool, error)) (string, error) {
+	base := Slugify(name)
+	if base == "" {
+		base = fallback
+	}
+	slug := base
+	for n := 2; ; n++ {
+		used, err := taken(slug)
+		if err != nil || !used {
+			return slug, err
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+}